@@ -4,27 +4,64 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/base64"
 	"fmt"
+	"net/http"
+	"path/filepath"
 	"sync"
 	"time"
 
 	"github.com/indece-official/go-gousu/v2/gousu"
 	"github.com/indece-official/go-gousu/v2/gousu/logger"
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/indece-official/monitor-agent-linux/src/utils"
 	"github.com/namsral/flag"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 )
 
 const ControllerName = "agent"
 
 var (
-	serverHost      = flag.String("server_host", "0.0.0.0", "")
-	serverPort      = flag.Int("server_port", 9440, "")
-	serverCACrt     = flag.String("ca_crt", "", "")
-	serverClientCrt = flag.String("client_crt", "", "")
-	serverClientKey = flag.String("client_key", "", "")
+	serverHost             = flag.String("server_host", "0.0.0.0", "")
+	serverPort             = flag.Int("server_port", 9440, "")
+	serverCACrt            = flag.String("ca_crt", "", "")
+	serverClientCrt        = flag.String("client_crt", "", "")
+	serverClientKey        = flag.String("client_key", "", "")
+	serverCACrtFile        = flag.String("ca_crt_file", "", "")
+	serverClientCrtFile    = flag.String("client_crt_file", "", "")
+	serverClientKeyFile    = flag.String("client_key_file", "", "")
+	clientCrtExpiryWarning = flag.Duration("client_crt_expiry_warning", 14*24*time.Hour, "")
+	clientCrtCheckInterval = flag.Duration("client_crt_check_interval", 1*time.Hour, "")
+	stateDir               = flag.String("state_dir", "/var/lib/indece-monitor/agent-linux", "")
+	spoolMaxSize           = flag.Int64("spool_max_size", 64*1024*1024, "")
+	spoolMaxAge            = flag.Duration("spool_max_age", 7*24*time.Hour, "")
+	scheduleMode           = flag.String("schedule_mode", ScheduleModeServer, "")
+	serverCheckExpiry      = flag.Duration("server_check_expiry", 24*time.Hour, "")
+	checkTimeout           = flag.Duration("check_timeout", 60*time.Second, "")
+	checkLimit             = flag.Int("check_concurrency", 8, "")
+	checkTypeLimits        = flag.String("check_concurrency_per_type", "aptupdates=1", "")
+	checkQueueSize         = flag.Int("check_queue_size", 100, "")
+	reconnectBackoffMin    = flag.Duration("reconnect_backoff_min", 1*time.Second, "")
+	reconnectBackoffMax    = flag.Duration("reconnect_backoff_max", 2*time.Minute, "")
+	keepaliveTime          = flag.Duration("grpc_keepalive_time", 5*time.Minute, "")
+	keepaliveTimeout       = flag.Duration("grpc_keepalive_timeout", 20*time.Second, "")
+	shutdownDrainTimeout   = flag.Duration("shutdown_drain_timeout", 10*time.Second, "")
+	agentInfoInterval      = flag.Duration("agent_info_interval", 10*time.Minute, "")
+	localChecksFile        = flag.String("checks_file", "", "")
+	localChecksDir         = flag.String("checks_dir", "/etc/indece-monitor/checks.d", "")
+	metricsListen          = flag.String("metrics_listen", "", "")
+	statusSocket           = flag.String("status_socket", "", "")
+	statusListen           = flag.String("status_listen", "", "")
+	pluginDir              = flag.String("plugin_dir", "/usr/lib/indece-monitor/plugins", "")
+	pluginTimeout          = flag.Duration("plugin_timeout", 10*time.Second, "")
+	disabledCheckers       = flag.String("disabled_checkers", "", "")
+	excludedChecks         = flag.String("excluded_checks", "", "")
+	checkParamOverrides    = flag.String("check_params", "", "")
+	diskIgnoreFstypes      = flag.String("disk_ignore_fstypes", "squashfs", "")
+	persistCheckState      = flag.Bool("persist_check_state", false, "")
 )
 
 type IController interface {
@@ -32,13 +69,42 @@ type IController interface {
 }
 
 type Controller struct {
-	log           *logger.Log
-	grpcConn      *grpc.ClientConn
-	checkers      map[string]IChecker
-	grpcClient    apiagent.AgentClient
-	stop          bool
-	error         error
-	waitGroupStop sync.WaitGroup
+	log              *logger.Log
+	grpcConn         *grpc.ClientConn
+	checkers         map[string]IChecker
+	builtinCheckers  map[string]bool
+	checkFilter      *checkFilter
+	nagiosChecker    *NagiosChecker
+	grpcClient       apiagent.AgentClient
+	clientCrtLoader  *clientCrtLoader
+	spool            *resultSpool
+	checkStates      *checkStateStore
+	checkPool        *checkPool
+	scheduler        *checkScheduler
+	results          *resultCache
+	metrics          *agentMetrics
+	metricsServer    *http.Server
+	statusServer     *http.Server
+	mutexAgentInfo   sync.Mutex
+	agentInfo        *apiagent.RegisterAgentV1Request
+	mutexLocalChecks sync.Mutex
+	localChecks      []*apiagent.CheckV1
+	checkClient      apiagent.Agent_CheckV1Client
+	mutexCheckClient sync.Mutex
+	mutexConnState   sync.Mutex
+	connState        connectivity.State
+	connGeneration   uint64
+	connStateChanged chan struct{}
+	ctx              context.Context
+	cancel           context.CancelFunc
+	ctxChecks        context.Context
+	cancelChecks     context.CancelFunc
+	mutexChecks      sync.Mutex
+	stopping         bool
+	waitGroupChecks  sync.WaitGroup
+	mutexError       sync.Mutex
+	error            error
+	waitGroupStop    sync.WaitGroup
 }
 
 var _ IController = (*Controller)(nil)
@@ -48,45 +114,174 @@ func (c *Controller) Name() string {
 }
 
 func (c *Controller) addChecker(checker IChecker) {
+	if !c.checkFilter.CheckerEnabled(checker.GetType()) {
+		c.log.Infof("Checker %s is disabled", checker.GetType())
+
+		return
+	}
+
 	c.checkers[checker.GetType()] = checker
 }
 
-func (c *Controller) Start() error {
+// addCheckers creates all checkers, the agent checker is only added if a
+// client certificate is loaded
+func (c *Controller) addCheckers() {
 	c.checkers = map[string]IChecker{}
+	c.nagiosChecker = NewNagiosChecker()
+
+	checkers := []IChecker{
+		NewAptUpdatesChecker(),
+		NewDockerContainerChecker(),
+		NewCpuChecker(),
+		NewDiskChecker(splitList(*diskIgnoreFstypes)),
+		NewFileChecker(),
+		NewHttpChecker(),
+		NewJournalChecker(),
+		NewLogfileChecker(),
+		NewMemoryChecker(),
+		c.nagiosChecker,
+		NewNetifChecker(),
+		NewOSChecker(),
+		NewPingChecker(),
+		NewProcessChecker(),
+		NewSystemdChecker(),
+		NewUptimeChecker(),
+	}
+
+	if c.clientCrtLoader != nil {
+		checkers = append([]IChecker{NewAgentChecker(c.clientCrtLoader)}, checkers...)
+	}
+
+	// Types of all built-in checkers, including disabled ones
+	c.builtinCheckers = map[string]bool{
+		CheckerTypeAgent: true,
+	}
+
+	for _, checker := range checkers {
+		c.builtinCheckers[checker.GetType()] = true
+
+		c.addChecker(checker)
+	}
+}
+
+func (c *Controller) Start() (err error) {
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.ctxChecks, c.cancelChecks = context.WithCancel(context.Background())
+
+	caCrtRaw, err := loadPEM("ca crt", *serverCACrtFile, *serverCACrt)
+	if err != nil {
+		return err
+	}
+
+	c.clientCrtLoader, err = newClientCrtLoader(
+		*serverClientCrtFile,
+		*serverClientKeyFile,
+		*serverClientCrt,
+		*serverClientKey,
+	)
+	if err != nil {
+		return err
+	}
 
-	c.addChecker(NewAptUpdatesChecker())
-	c.addChecker(NewDockerContainerChecker())
-	c.addChecker(NewCpuChecker())
-	c.addChecker(NewDiskChecker())
-	c.addChecker(NewFileChecker())
-	c.addChecker(NewHttpChecker())
-	c.addChecker(NewMemoryChecker())
-	c.addChecker(NewOSChecker())
-	c.addChecker(NewPingChecker())
-	c.addChecker(NewProcessChecker())
-	c.addChecker(NewUptimeChecker())
-
-	caCrtRaw, err := base64.StdEncoding.DecodeString(*serverCACrt)
+	c.checkFilter, err = newCheckFilter(*disabledCheckers, *excludedChecks, *checkParamOverrides)
 	if err != nil {
-		return fmt.Errorf("error base64-decoding ca crt: %s", err)
+		return fmt.Errorf("error parsing check filter: %s", err)
 	}
 
-	clientCrtRaw, err := base64.StdEncoding.DecodeString(*serverClientCrt)
+	c.addCheckers()
+	c.addPluginCheckers()
+
+	localChecks, commands, err := c.loadLocalChecks()
 	if err != nil {
-		return fmt.Errorf("error base64-decoding client crt: %s", err)
+		return fmt.Errorf("error loading local checks: %s", err)
 	}
 
-	clientKeyRaw, err := base64.StdEncoding.DecodeString(*serverClientKey)
+	c.setLocalChecks(localChecks, commands)
+
+	spool, err := newResultSpool(
+		filepath.Join(*stateDir, "spool"),
+		*spoolMaxSize,
+		*spoolMaxAge,
+	)
 	if err != nil {
-		return fmt.Errorf("error base64-decoding client key: %s", err)
+		return fmt.Errorf("error initializing result spool: %s", err)
 	}
 
-	clientCrt, err := tls.X509KeyPair(
-		clientCrtRaw,
-		clientKeyRaw,
+	c.spool = spool
+
+	c.checkStates, err = newCheckStateStore(
+		filepath.Join(*stateDir, "check_state.json"),
+		*persistCheckState,
 	)
 	if err != nil {
-		return err
+		return fmt.Errorf("error initializing check state: %s", err)
+	}
+
+	if *checkLimit < 1 {
+		return fmt.Errorf("invalid check concurrency %d: must be at least 1", *checkLimit)
+	}
+
+	typeLimits, err := parseCheckerTypeLimits(*checkTypeLimits)
+	if err != nil {
+		return fmt.Errorf("error parsing check concurrency per type: %s", err)
+	}
+
+	c.checkPool = newCheckPool(*checkLimit, typeLimits, *checkQueueSize)
+	c.results = newResultCache()
+	c.metrics = newAgentMetrics(c)
+
+	// Close the listeners again if a later step fails
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		if c.metricsServer != nil {
+			c.stopMetricsServer()
+		}
+
+		if c.statusServer != nil {
+			c.stopStatusAPI()
+		}
+	}()
+
+	if *metricsListen != "" {
+		err = c.startMetricsServer()
+		if err != nil {
+			return fmt.Errorf("error starting metrics server: %s", err)
+		}
+	}
+
+	err = c.startStatusAPI()
+	if err != nil {
+		return fmt.Errorf("error starting status api: %s", err)
+	}
+
+	switch *scheduleMode {
+	case ScheduleModeServer:
+		// Checks are only run when requested by the server
+	case ScheduleModeAgent:
+		c.scheduler, err = newCheckScheduler(
+			c.log,
+			filepath.Join(*stateDir, "checks.json"),
+			*serverCheckExpiry,
+			c.runScheduledCheck,
+		)
+		if err != nil {
+			return fmt.Errorf("error initializing check scheduler: %s", err)
+		}
+
+		err = c.scheduler.SetLocalChecks(c.localScheduledChecks())
+		if err != nil {
+			return fmt.Errorf("error scheduling local checks: %s", err)
+		}
+
+		err = c.scheduler.Start()
+		if err != nil {
+			return fmt.Errorf("error starting check scheduler: %s", err)
+		}
+	default:
+		return fmt.Errorf("invalid schedule mode '%s'", *scheduleMode)
 	}
 
 	rootCAs := x509.NewCertPool()
@@ -95,18 +290,26 @@ func (c *Controller) Start() error {
 	}
 
 	creds := credentials.NewTLS(&tls.Config{
-		RootCAs: rootCAs,
-		Certificates: []tls.Certificate{
-			clientCrt,
-		},
+		RootCAs:              rootCAs,
+		GetClientCertificate: c.clientCrtLoader.GetClientCertificate,
 	})
-	if err != nil {
-		return fmt.Errorf("failed to load tls certs: %s", err)
-	}
 
 	c.grpcConn, err = grpc.Dial(
 		fmt.Sprintf("%s:%d", *serverHost, *serverPort),
 		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:    *keepaliveTime,
+			Timeout: *keepaliveTimeout,
+		}),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff: backoff.Config{
+				BaseDelay:  *reconnectBackoffMin,
+				Multiplier: backoff.DefaultConfig.Multiplier,
+				Jitter:     backoff.DefaultConfig.Jitter,
+				MaxDelay:   *reconnectBackoffMax,
+			},
+			MinConnectTimeout: 20 * time.Second,
+		}),
 	)
 	if err != nil {
 		return fmt.Errorf(
@@ -119,66 +322,119 @@ func (c *Controller) Start() error {
 
 	c.grpcClient = apiagent.NewAgentClient(c.grpcConn)
 
-	ctx := context.Background()
+	c.connState = connectivity.Idle
+	c.connStateChanged = make(chan struct{})
 
 	c.waitGroupStop.Add(1)
 	go func() {
-		for !c.stop {
-			c.error = nil
+		c.watchConnection()
 
-			err := c.pingLoop(context.Background())
-			if err != nil {
-				c.error = err
+		c.waitGroupStop.Done()
+	}()
 
-				c.log.Errorf("Error in piing loop: %s", err)
-			}
+	c.waitGroupStop.Add(1)
+	go func() {
+		c.clientCrtLoop(c.ctx)
 
-			time.Sleep(5 * time.Second)
-		}
+		c.waitGroupStop.Done()
+	}()
+
+	c.waitGroupStop.Add(1)
+	go func() {
+		c.agentInfoLoop(c.ctx)
 
 		c.waitGroupStop.Done()
 	}()
 
 	c.waitGroupStop.Add(1)
 	go func() {
-		for !c.stop {
-			time.Sleep(5 * time.Second)
+		c.localChecksReloadLoop(c.ctx)
+
+		c.waitGroupStop.Done()
+	}()
 
-			c.error = nil
+	c.waitGroupStop.Add(1)
+	go func() {
+		retryBackoff := utils.NewBackoff(*reconnectBackoffMin, *reconnectBackoffMax)
 
-			err = c.registerAgent(ctx)
+		for c.ctx.Err() == nil {
+			_, err := c.awaitConnection(c.ctx)
 			if err != nil {
-				c.error = err
+				c.log.Warnf("Error waiting for connection: %s", err)
 
-				c.log.Errorf("Error in registering agent: %s", err)
+				utils.SleepContext(c.ctx, retryBackoff.Next())
 
 				continue
 			}
 
-			err = c.registerCheckers(ctx)
+			c.setError(nil)
+
+			startedAt := time.Now()
+
+			err = c.pingLoop(c.ctx)
 			if err != nil {
-				c.error = err
+				c.setError(err)
 
-				c.log.Errorf("Error registering checkers: %s", err)
+				c.log.Errorf("Error in ping loop: %s", err)
+			}
 
-				continue
+			if time.Since(startedAt) > *reconnectBackoffMax {
+				retryBackoff.Reset()
 			}
 
-			err = c.registerChecks(ctx)
+			utils.SleepContext(c.ctx, retryBackoff.Next())
+		}
+
+		c.waitGroupStop.Done()
+	}()
+
+	c.waitGroupStop.Add(1)
+	go func() {
+		retryBackoff := utils.NewBackoff(*reconnectBackoffMin, *reconnectBackoffMax)
+		registeredGeneration := uint64(0)
+
+		for c.ctx.Err() == nil {
+			generation, err := c.awaitConnection(c.ctx)
 			if err != nil {
-				c.error = err
+				c.log.Warnf("Error waiting for connection: %s", err)
 
-				c.log.Errorf("Error registering checks: %s", err)
+				utils.SleepContext(c.ctx, retryBackoff.Next())
 
 				continue
 			}
 
-			err := c.checkLoop(context.Background())
+			c.setError(nil)
+
+			// Only register again after the connection to the server was lost
+			if generation != registeredGeneration {
+				err = c.register(c.ctx)
+				if err != nil {
+					c.setError(err)
+
+					c.log.Errorf("%s", err)
+
+					utils.SleepContext(c.ctx, retryBackoff.Next())
+
+					continue
+				}
+
+				registeredGeneration = generation
+			}
+
+			startedAt := time.Now()
+
+			err = c.checkLoop(c.ctx)
 			if err != nil {
-				c.error = err
+				c.setError(err)
 
 				c.log.Errorf("Error in check loop: %s", err)
 			}
+
+			if time.Since(startedAt) > *reconnectBackoffMax {
+				retryBackoff.Reset()
+			}
+
+			utils.SleepContext(c.ctx, retryBackoff.Next())
 		}
 
 		c.waitGroupStop.Done()
@@ -187,12 +443,106 @@ func (c *Controller) Start() error {
 	return nil
 }
 
+func (c *Controller) register(ctx context.Context) error {
+	err := c.registerAgent(ctx)
+	if err != nil {
+		return fmt.Errorf("error registering agent: %s", err)
+	}
+
+	err = c.registerCheckers(ctx)
+	if err != nil {
+		return fmt.Errorf("error registering checkers: %s", err)
+	}
+
+	err = c.registerChecks(ctx)
+	if err != nil {
+		return fmt.Errorf("error registering checks: %s", err)
+	}
+
+	return nil
+}
+
+func (c *Controller) setError(err error) {
+	c.mutexError.Lock()
+	defer c.mutexError.Unlock()
+
+	c.error = err
+}
+
+// trackCheck registers a check about to run, returns false if the controller
+// is stopping and no new checks may be started
+func (c *Controller) trackCheck() bool {
+	c.mutexChecks.Lock()
+	defer c.mutexChecks.Unlock()
+
+	if c.stopping {
+		return false
+	}
+
+	c.waitGroupChecks.Add(1)
+
+	return true
+}
+
+// awaitChecks waits for all running checks to finish, returns false if
+// they didn't finish within the timeout
+func (c *Controller) awaitChecks(timeout time.Duration) bool {
+	done := make(chan struct{})
+
+	go func() {
+		c.waitGroupChecks.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 func (c *Controller) Health() error {
-	return c.error
+	c.mutexError.Lock()
+	err := c.error
+	c.mutexError.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return c.checkPool.Health()
 }
 
 func (c *Controller) Stop() error {
-	c.stop = true
+	c.mutexChecks.Lock()
+	c.stopping = true
+	c.mutexChecks.Unlock()
+
+	if c.scheduler != nil {
+		c.scheduler.Stop()
+	}
+
+	// Give running checks some time to finish and send their results
+	if !c.awaitChecks(*shutdownDrainTimeout) {
+		c.log.Warnf("Cancelling checks still running after %s", *shutdownDrainTimeout)
+
+		c.cancelChecks()
+
+		if !c.awaitChecks(5 * time.Second) {
+			c.log.Warnf("Results of cancelled checks are lost")
+		}
+	}
+
+	c.cancel()
+
+	if c.metricsServer != nil {
+		c.stopMetricsServer()
+	}
+
+	if c.statusServer != nil {
+		c.stopStatusAPI()
+	}
 
 	if c.grpcConn != nil {
 		err := c.grpcConn.Close()
@@ -203,6 +553,15 @@ func (c *Controller) Stop() error {
 
 	c.waitGroupStop.Wait()
 
+	c.cancelChecks()
+
+	if c.checkStates != nil {
+		err := c.checkStates.Save()
+		if err != nil {
+			c.log.Warnf("Error saving check state: %s", err)
+		}
+	}
+
 	c.grpcConn = nil
 
 	return nil
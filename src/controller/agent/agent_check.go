@@ -4,48 +4,308 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-func (c *Controller) check(
-	ctx context.Context,
-	checkClient apiagent.Agent_CheckV1Client,
-	mutexCheckClientSend *sync.Mutex,
-	checkRequest *apiagent.CheckV1Request,
-) error {
+type checkOutput struct {
+	status  apiagent.CheckV1Status
+	message string
+	values  []*apiagent.CheckV1Value
+	err     error
+}
+
+// checkTimeout returns the timeout of the request, falling back to the
+// default timeout of the checker and the global check timeout
+func (c *Controller) checkTimeout(checker IChecker, checkRequest *apiagent.CheckV1Request) time.Duration {
+	timeouts := []string{checkRequest.Timeout}
+
+	reqChecker, err := checker.GetChecker()
+	if err == nil {
+		timeouts = append(timeouts, reqChecker.DefaultTimeout)
+	}
+
+	for _, timeoutStr := range timeouts {
+		if timeoutStr == "" {
+			continue
+		}
+
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil || timeout <= 0 {
+			c.log.Warnf("Ignoring invalid timeout '%s' for check %s", timeoutStr, checkRequest.CheckUID)
+
+			continue
+		}
+
+		return timeout
+	}
+
+	return *checkTimeout
+}
+
+func newCheckResult(checkRequest *apiagent.CheckV1Request) *apiagent.CheckV1Result {
 	checkResult := &apiagent.CheckV1Result{}
 	checkResult.ActionUID = checkRequest.ActionUID
 	checkResult.CheckUID = checkRequest.CheckUID
 	checkResult.Values = []*apiagent.CheckV1Value{}
 
+	return checkResult
+}
+
+// check runs a check, the state of the check between its runs is stored
+// under stateKey (no state is stored if empty)
+//
+// If the checker is left behind after a timeout, the returned channel is
+// closed once it has returned, otherwise it is nil
+func (c *Controller) check(
+	ctx context.Context,
+	stateKey string,
+	checkRequest *apiagent.CheckV1Request,
+) (*apiagent.CheckV1Result, <-chan struct{}) {
+	checkResult := newCheckResult(checkRequest)
+
+	var abandoned chan struct{}
+
 	checker, ok := c.checkers[checkRequest.CheckerType]
 	if !ok {
+		checkResult.Status = apiagent.CheckV1Status_CheckV1StatusUnknown
 		checkResult.Error = "Unknown checker type"
 		checkResult.Message = "Error: unknown checker type"
+	} else if reqChecker, err := checker.GetChecker(); err != nil {
+		checkResult.Status = apiagent.CheckV1Status_CheckV1StatusUnknown
+		checkResult.Error = fmt.Sprintf("error loading checker: %s", err)
+		checkResult.Message = fmt.Sprintf("Error: error loading checker: %s", err)
+	} else if params, thresholds, err := splitThresholdParams(reqChecker, checkRequest.Params); err != nil {
+		checkResult.Status = apiagent.CheckV1Status_CheckV1StatusUnknown
+		checkResult.Error = err.Error()
+		checkResult.Message = fmt.Sprintf("Error: %s", err)
 	} else {
-		message, values, err := checker.Check(ctx, checkRequest.Params)
-		if err != nil {
-			checkResult.Error = err.Error()
-			checkResult.Message = err.Error()
+		if unknownParams := unknownCheckParams(reqChecker, params); len(unknownParams) > 0 {
+			c.log.Warnf("Ignoring unknown parameters %s for check %s", strings.Join(unknownParams, ", "), checkRequest.CheckUID)
+		}
+
+		timeout := c.checkTimeout(checker, checkRequest)
+		startedAt := time.Now()
+		defer func() {
+			duration := time.Since(startedAt)
+
+			checkResult.Duration = durationpb.New(duration)
+			c.metrics.observeCheck(checkRequest.CheckerType, duration, checkResult)
+		}()
+
+		ctxCheck, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		ctxChecker := ctxCheck
+		if stateKey != "" {
+			ctxChecker = withCheckState(ctxCheck, c.checkStates.State(stateKey))
+		}
+
+		chanOutput := make(chan *checkOutput, 1)
+		chanDone := make(chan struct{})
+
+		go func() {
+			defer close(chanDone)
+
+			status, message, values, err := checker.Check(ctxChecker, params)
+
+			chanOutput <- &checkOutput{
+				status:  status,
+				message: message,
+				values:  values,
+				err:     err,
+			}
+		}()
+
+		var output *checkOutput
+
+		select {
+		case output = <-chanOutput:
+		case <-ctxCheck.Done():
+			// The checker doesn't respect the context, so leave it behind
+			abandoned = chanDone
+		}
+
+		if output != nil && output.err == nil {
+			thresholdStatus, thresholdMessages := evaluateThresholds(reqChecker, thresholds, output.values)
+
+			checkResult.Status = worseCheckStatus(output.status, thresholdStatus)
+			checkResult.Message = output.message
+			checkResult.Values = output.values
+
+			if len(thresholdMessages) > 0 {
+				checkResult.Message = fmt.Sprintf(
+					"%s\n%s",
+					strings.TrimRight(output.message, "\n"),
+					strings.Join(thresholdMessages, "\n"),
+				)
+			}
+		} else if ctxCheck.Err() == context.DeadlineExceeded {
+			// Errors of checks killed by the deadline are reported as timeout
+			checkResult.Status = apiagent.CheckV1Status_CheckV1StatusUnknown
+			checkResult.TimedOut = true
+			checkResult.Error = fmt.Sprintf("check timed out after %s", timeout)
+			checkResult.Message = fmt.Sprintf("Error: check timed out after %s", timeout)
+		} else if output != nil {
+			checkResult.Status = output.status
+			if checkResult.Status == apiagent.CheckV1Status_CheckV1StatusOK {
+				checkResult.Status = apiagent.CheckV1Status_CheckV1StatusCritical
+			}
+			checkResult.Error = output.err.Error()
+			checkResult.Message = output.err.Error()
+			if output.values != nil {
+				checkResult.Values = output.values
+			}
 		} else {
-			checkResult.Message = message
-			checkResult.Values = values
+			checkResult.Status = apiagent.CheckV1Status_CheckV1StatusUnknown
+			checkResult.Error = fmt.Sprintf("check cancelled: %s", ctxCheck.Err())
+			checkResult.Message = fmt.Sprintf("Error: check cancelled: %s", ctxCheck.Err())
+		}
+	}
+
+	checkResult.MeasuredAt = timestamppb.Now()
+
+	if stateKey != "" {
+		// Save the state after each run, so it survives crashes
+		err := c.checkStates.Save()
+		if err != nil {
+			c.log.Warnf("Error saving check state: %s", err)
+		}
+	}
+
+	return checkResult, abandoned
+}
+
+// runCheck runs a check in the check pool, sharing the result with
+// concurrent requests for the same check
+func (c *Controller) runCheck(
+	ctx context.Context,
+	key string,
+	checkRequest *apiagent.CheckV1Request,
+) *apiagent.CheckV1Result {
+	stateKey := key
+
+	if key == "" {
+		// Never coalesce requests without check uid
+		key = fmt.Sprintf("action:%s", checkRequest.ActionUID)
+	}
+
+	sharedCheckResult, err := c.checkPool.Do(
+		ctx,
+		key,
+		checkRequest.CheckerType,
+		func() (*apiagent.CheckV1Result, <-chan struct{}) {
+			return c.check(ctx, stateKey, checkRequest)
+		},
+	)
+	if err != nil {
+		checkResult := newCheckResult(checkRequest)
+		checkResult.Status = apiagent.CheckV1Status_CheckV1StatusUnknown
+		checkResult.Error = err.Error()
+		checkResult.Message = fmt.Sprintf("Error: %s", err)
+		checkResult.MeasuredAt = timestamppb.Now()
+
+		return checkResult
+	}
+
+	checkResult := proto.Clone(sharedCheckResult).(*apiagent.CheckV1Result)
+	checkResult.ActionUID = checkRequest.ActionUID
+
+	return checkResult
+}
+
+// reportResult stores a result as latest result of the check and sends it
+func (c *Controller) reportResult(name string, checkRequest *apiagent.CheckV1Request, checkResult *apiagent.CheckV1Result) error {
+	c.results.Update(name, checkRequest, checkResult)
+
+	return c.sendResult(checkResult)
+}
+
+// sendResult sends a result on the active check stream or adds it to the
+// spool if there is none or sending fails
+func (c *Controller) sendResult(checkResult *apiagent.CheckV1Result) error {
+	c.mutexCheckClient.Lock()
+	defer c.mutexCheckClient.Unlock()
+
+	if c.checkClient != nil {
+		checkResult.SentAt = timestamppb.Now()
+
+		err := c.checkClient.Send(checkResult)
+		if err == nil {
+			return nil
 		}
+
+		c.log.Warnf("Error sending result, adding it to spool: %s", err)
+
+		c.checkClient = nil
+		checkResult.SentAt = nil
+	}
+
+	err := c.spool.Add(checkResult)
+	if err != nil {
+		return fmt.Errorf("error adding result to spool: %s", err)
+	}
+
+	return nil
+}
+
+// attachCheckClient replays all spooled results on a new check stream and
+// then uses the stream for new results
+//
+// The replayed results stay in the spool until confirmReplay is called
+func (c *Controller) attachCheckClient(checkClient apiagent.Agent_CheckV1Client) error {
+	c.mutexCheckClient.Lock()
+	defer c.mutexCheckClient.Unlock()
+
+	countSpooled := c.spool.Len()
+	if countSpooled > 0 {
+		c.log.Infof("Replaying %d spooled results", countSpooled)
 	}
 
-	mutexCheckClientSend.Lock()
-	defer mutexCheckClientSend.Unlock()
+	err := c.spool.Replay(func(checkResult *apiagent.CheckV1Result) error {
+		checkResult.SentAt = timestamppb.Now()
 
-	err := checkClient.Send(checkResult)
+		return checkClient.Send(checkResult)
+	})
 	if err != nil {
-		return fmt.Errorf("error sending result: %s", err)
+		return fmt.Errorf("error replaying spooled results: %s", err)
 	}
 
+	c.checkClient = checkClient
+
 	return nil
 }
 
+// confirmReplay removes the replayed results from the spool once the check
+// stream they were sent on has proven healthy
+func (c *Controller) confirmReplay() {
+	c.mutexCheckClient.Lock()
+	defer c.mutexCheckClient.Unlock()
+
+	if c.checkClient == nil {
+		return
+	}
+
+	err := c.spool.Confirm()
+	if err != nil {
+		c.log.Warnf("Error removing replayed results from spool: %s", err)
+	}
+}
+
+func (c *Controller) detachCheckClient(checkClient apiagent.Agent_CheckV1Client) {
+	c.mutexCheckClient.Lock()
+	defer c.mutexCheckClient.Unlock()
+
+	if c.checkClient == checkClient {
+		c.checkClient = nil
+	}
+}
+
 func (c *Controller) checkLoop(ctx context.Context) error {
 	c.log.Infof("Starting check receiver")
 	defer c.log.Infof("Stopped check receiver")
@@ -55,11 +315,16 @@ func (c *Controller) checkLoop(ctx context.Context) error {
 		return fmt.Errorf("error receiving config: %s", err)
 	}
 	defer checkClient.CloseSend()
-	mutexCheckClientSend := &sync.Mutex{}
 
-	for !c.stop {
+	err = c.attachCheckClient(checkClient)
+	if err != nil {
+		return err
+	}
+	defer c.detachCheckClient(checkClient)
+
+	for {
 		checkRequest, err := checkClient.Recv()
-		if err == io.EOF {
+		if err == io.EOF || ctx.Err() != nil {
 			return nil
 		}
 
@@ -67,18 +332,37 @@ func (c *Controller) checkLoop(ctx context.Context) error {
 			return err
 		}
 
+		c.confirmReplay()
+
+		// Checks of the server are run by the scheduler in agent-scheduled
+		// mode, one-time requests and checks failing to schedule are run now
+		if c.scheduler != nil && checkRequest.CheckUID != "" {
+			check, err := c.scheduledCheckFromRequest(checkRequest)
+			if err == nil {
+				err = c.scheduler.AddServerCheck(check)
+			}
+			if err == nil {
+				continue
+			}
+
+			c.log.Warnf("Error scheduling check %s, running it once: %s", checkRequest.CheckUID, err)
+		}
+
+		if !c.trackCheck() {
+			c.log.Warnf("Ignoring check request %s while stopping", checkRequest.ActionUID)
+
+			continue
+		}
+
 		go func() {
-			err := c.check(
-				ctx,
-				checkClient,
-				mutexCheckClientSend,
-				checkRequest,
-			)
+			defer c.waitGroupChecks.Done()
+
+			checkResult := c.runCheck(c.ctxChecks, checkRequest.CheckUID, checkRequest)
+
+			err := c.reportResult("", checkRequest, checkResult)
 			if err != nil {
-				c.log.Errorf("error running check: %s", err)
+				c.log.Errorf("error sending check result: %s", err)
 			}
 		}()
 	}
-
-	return nil
 }
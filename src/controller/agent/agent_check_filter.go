@@ -0,0 +1,170 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+)
+
+// checkFilter disables checkers and excludes or modifies the autodiscovered
+// checks of the checkers
+type checkFilter struct {
+	disabledCheckers map[string]bool
+	excludedChecks   []*regexp.Regexp
+	paramOverrides   map[string][]*apiagent.CheckV1Param
+}
+
+// globRegexp converts a glob to a regexp, "*" matches any characters
+// (including "/") and "?" a single character
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	expr := strings.Builder{}
+	expr.WriteString("^")
+
+	for _, r := range glob {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
+}
+
+func splitList(str string) []string {
+	parts := []string{}
+
+	for _, part := range strings.Split(str, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
+
+// CheckerEnabled returns false if a checker is disabled by its full or
+// short type
+func (f *checkFilter) CheckerEnabled(checkerType string) bool {
+	return !f.disabledCheckers[checkerType] && !f.disabledCheckers[checkerShortType(checkerType)]
+}
+
+// excluded returns true if the full type, the short type (e.g. "disk:/boot")
+// or the name of a check matches an excluded glob
+func (f *checkFilter) excluded(reqCheck *apiagent.CheckV1) bool {
+	names := []string{
+		reqCheck.Type,
+		reqCheck.Name,
+	}
+
+	if strings.HasPrefix(reqCheck.Type, reqCheck.CheckerType) {
+		names = append(names, checkerShortType(reqCheck.CheckerType)+strings.TrimPrefix(reqCheck.Type, reqCheck.CheckerType))
+	}
+
+	for _, excludedCheck := range f.excludedChecks {
+		for _, name := range names {
+			if excludedCheck.MatchString(name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// overrideParams sets the configured params of the checker of a check
+func (f *checkFilter) overrideParams(reqCheck *apiagent.CheckV1) {
+	overrides := append(
+		append([]*apiagent.CheckV1Param{}, f.paramOverrides[checkerShortType(reqCheck.CheckerType)]...),
+		f.paramOverrides[reqCheck.CheckerType]...,
+	)
+
+	for _, override := range overrides {
+		found := false
+
+		for _, param := range reqCheck.Params {
+			if param.Name == override.Name {
+				param.Value = override.Value
+				found = true
+			}
+		}
+
+		if !found {
+			reqCheck.Params = append(reqCheck.Params, &apiagent.CheckV1Param{
+				Name:  override.Name,
+				Value: override.Value,
+			})
+		}
+	}
+}
+
+// Apply removes excluded checks from the autodiscovered checks of a checker
+// and overrides their params
+func (f *checkFilter) Apply(reqChecks []*apiagent.CheckV1) []*apiagent.CheckV1 {
+	filteredChecks := []*apiagent.CheckV1{}
+
+	for _, reqCheck := range reqChecks {
+		if f.excluded(reqCheck) {
+			continue
+		}
+
+		f.overrideParams(reqCheck)
+
+		filteredChecks = append(filteredChecks, reqCheck)
+	}
+
+	return filteredChecks
+}
+
+// newCheckFilter parses the disabled checkers and excluded checks in the
+// format "<glob>,..." and the param overrides in the format
+// "<checker-type>:<param>=<value>,..."
+func newCheckFilter(disabledCheckers string, excludedChecks string, paramOverrides string) (*checkFilter, error) {
+	f := &checkFilter{
+		disabledCheckers: map[string]bool{},
+		excludedChecks:   []*regexp.Regexp{},
+		paramOverrides:   map[string][]*apiagent.CheckV1Param{},
+	}
+
+	for _, checkerType := range splitList(disabledCheckers) {
+		f.disabledCheckers[checkerType] = true
+	}
+
+	for _, glob := range splitList(excludedChecks) {
+		excludedCheck, err := globRegexp(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid excluded check '%s': %s", glob, err)
+		}
+
+		f.excludedChecks = append(f.excludedChecks, excludedCheck)
+	}
+
+	for _, part := range splitList(paramOverrides) {
+		partParts := strings.SplitN(part, ":", 2)
+		if len(partParts) != 2 {
+			return nil, fmt.Errorf("invalid param override '%s': must have format <checker-type>:<param>=<value>", part)
+		}
+
+		paramParts := strings.SplitN(partParts[1], "=", 2)
+		if len(paramParts) != 2 || paramParts[0] == "" {
+			return nil, fmt.Errorf("invalid param override '%s': must have format <checker-type>:<param>=<value>", part)
+		}
+
+		checkerType := strings.TrimSpace(partParts[0])
+
+		f.paramOverrides[checkerType] = append(f.paramOverrides[checkerType], &apiagent.CheckV1Param{
+			Name:  strings.TrimSpace(paramParts[0]),
+			Value: strings.TrimSpace(paramParts[1]),
+		})
+	}
+
+	return f, nil
+}
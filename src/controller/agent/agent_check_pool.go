@@ -0,0 +1,271 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+)
+
+var errCheckQueueFull = fmt.Errorf("check queue full")
+
+type checkPoolCall struct {
+	done   chan struct{}
+	result *apiagent.CheckV1Result
+}
+
+// checkPool limits the number of concurrently running checks (globally and
+// per checker type) and coalesces requests for a check which is already
+// queued or running
+//
+// The queue is limited per checker type, so a checker type whose checks hang
+// can't block the checks of other types
+type checkPool struct {
+	slots        chan struct{}
+	typeLimits   map[string]int
+	typeSlots    map[string]chan struct{}
+	maxQueued    int
+	maxAbandoned int
+	mutex        sync.Mutex
+	calls        map[string]*checkPoolCall
+	queued       map[string]int
+	running      int
+	abandoned    int
+}
+
+func (p *checkPool) getTypeSlots(checkerType string) chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if slots, ok := p.typeSlots[checkerType]; ok {
+		return slots
+	}
+
+	limit, ok := p.typeLimits[checkerType]
+	if !ok {
+		limit, ok = p.typeLimits[checkerShortType(checkerType)]
+	}
+	if !ok {
+		return nil
+	}
+
+	p.typeSlots[checkerType] = make(chan struct{}, limit)
+
+	return p.typeSlots[checkerType]
+}
+
+func (p *checkPool) acquire(ctx context.Context, slots chan struct{}) error {
+	if slots == nil {
+		return nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *checkPool) release(slots chan struct{}) {
+	if slots == nil {
+		return
+	}
+
+	<-slots
+}
+
+func (p *checkPool) finish(key string, checkerType string, call *checkPoolCall, running bool) {
+	p.mutex.Lock()
+	if running {
+		p.running--
+	} else {
+		p.queued[checkerType]--
+	}
+	delete(p.calls, key)
+	p.mutex.Unlock()
+
+	close(call.done)
+}
+
+// Do runs the check identified by key as soon as there are free slots
+//
+// If the check is already queued or running, the call waits for it to finish
+// and returns its result instead. The returned result must not be modified.
+//
+// If run returns a channel (for a check left behind after a timeout), the
+// global slot is released, but the slot of the checker type is kept until
+// the channel is closed, so hanging checks only block checks of their type.
+func (p *checkPool) Do(
+	ctx context.Context,
+	key string,
+	checkerType string,
+	run func() (*apiagent.CheckV1Result, <-chan struct{}),
+) (*apiagent.CheckV1Result, error) {
+	p.mutex.Lock()
+
+	if call, ok := p.calls[key]; ok {
+		p.mutex.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if call.result == nil {
+			return nil, fmt.Errorf("coalesced check was not run")
+		}
+
+		return call.result, nil
+	}
+
+	if p.queued[checkerType] >= p.maxQueued {
+		p.mutex.Unlock()
+
+		return nil, errCheckQueueFull
+	}
+
+	call := &checkPoolCall{
+		done: make(chan struct{}),
+	}
+
+	p.calls[key] = call
+	p.queued[checkerType]++
+	p.mutex.Unlock()
+
+	typeSlots := p.getTypeSlots(checkerType)
+
+	// Wait for the per-type slot first, so waiting checks don't block global slots
+	err := p.acquire(ctx, typeSlots)
+	if err != nil {
+		p.finish(key, checkerType, call, false)
+
+		return nil, err
+	}
+
+	err = p.acquire(ctx, p.slots)
+	if err != nil {
+		p.release(typeSlots)
+		p.finish(key, checkerType, call, false)
+
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	p.queued[checkerType]--
+	p.running++
+	p.mutex.Unlock()
+
+	result, abandoned := run()
+
+	call.result = result
+
+	p.finish(key, checkerType, call, true)
+
+	p.release(p.slots)
+
+	if abandoned == nil {
+		p.release(typeSlots)
+	} else {
+		p.mutex.Lock()
+		p.abandoned++
+		p.mutex.Unlock()
+
+		go func() {
+			<-abandoned
+
+			p.mutex.Lock()
+			p.abandoned--
+			p.mutex.Unlock()
+
+			p.release(typeSlots)
+		}()
+	}
+
+	return call.result, nil
+}
+
+// Stats returns the number of queued and running checks, checks left behind
+// after a timeout count as running until they return
+func (p *checkPool) Stats() (int, int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	queued := 0
+	for _, typeQueued := range p.queued {
+		queued += typeQueued
+	}
+
+	return queued, p.running + p.abandoned
+}
+
+// Health returns an error if the queue of a checker type is full or too many
+// checks were left behind after a timeout
+func (p *checkPool) Health() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.abandoned >= p.maxAbandoned {
+		return fmt.Errorf("%d checks hang after their timeout", p.abandoned)
+	}
+
+	checkerTypes := []string{}
+	for checkerType, typeQueued := range p.queued {
+		if typeQueued >= p.maxQueued {
+			checkerTypes = append(checkerTypes, checkerType)
+		}
+	}
+
+	if len(checkerTypes) > 0 {
+		sort.Strings(checkerTypes)
+
+		return fmt.Errorf("check queue full for %s", strings.Join(checkerTypes, ", "))
+	}
+
+	return nil
+}
+
+// parseCheckerTypeLimits parses limits in the format "<checker-type>=<limit>,..."
+func parseCheckerTypeLimits(str string) (map[string]int, error) {
+	limits := map[string]int{}
+
+	for _, part := range strings.Split(str, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		partParts := strings.SplitN(part, "=", 2)
+		if len(partParts) != 2 {
+			return nil, fmt.Errorf("invalid limit '%s': must have format <checker-type>=<limit>", part)
+		}
+
+		limit, err := strconv.Atoi(strings.TrimSpace(partParts[1]))
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid limit '%s': limit must be a positive number", part)
+		}
+
+		limits[strings.TrimSpace(partParts[0])] = limit
+	}
+
+	return limits, nil
+}
+
+// newCheckPool creates a pool running up to limit checks at the same time,
+// the agent is unhealthy once as many checks hang after their timeout
+func newCheckPool(limit int, typeLimits map[string]int, maxQueued int) *checkPool {
+	return &checkPool{
+		slots:        make(chan struct{}, limit),
+		typeLimits:   typeLimits,
+		typeSlots:    map[string]chan struct{}{},
+		maxQueued:    maxQueued,
+		maxAbandoned: limit,
+		calls:        map[string]*checkPoolCall{},
+		queued:       map[string]int{},
+	}
+}
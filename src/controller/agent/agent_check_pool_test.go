@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+)
+
+func runCheckPoolResult() (*apiagent.CheckV1Result, <-chan struct{}) {
+	return &apiagent.CheckV1Result{}, nil
+}
+
+func TestCheckPoolAbandoned(t *testing.T) {
+	pool := newCheckPool(1, map[string]int{"hanging": 1}, 10)
+	abandoned := make(chan struct{})
+
+	_, err := pool.Do(context.Background(), "hanging", "hanging", func() (*apiagent.CheckV1Result, <-chan struct{}) {
+		return &apiagent.CheckV1Result{}, abandoned
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The left behind check keeps the slot of its type
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = pool.Do(ctx, "hanging2", "hanging", runCheckPoolResult)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// ... but not the global slot
+	_, err = pool.Do(context.Background(), "other", "other", runCheckPoolResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, running := pool.Stats(); running != 1 {
+		t.Errorf("got %d running checks, want 1", running)
+	}
+
+	if pool.Health() == nil {
+		t.Errorf("got healthy pool with hanging check")
+	}
+
+	close(abandoned)
+
+	_, err = pool.Do(context.Background(), "hanging2", "hanging", runCheckPoolResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, running := pool.Stats(); running != 0 {
+		t.Errorf("got %d running checks, want 0", running)
+	}
+
+	if err := pool.Health(); err != nil {
+		t.Errorf("got unhealthy pool: %s", err)
+	}
+}
+
+func TestCheckPoolQueuePerType(t *testing.T) {
+	pool := newCheckPool(2, map[string]int{"slow": 1}, 1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		_, _ = pool.Do(context.Background(), "slow1", "slow", func() (*apiagent.CheckV1Result, <-chan struct{}) {
+			close(started)
+			<-release
+
+			return &apiagent.CheckV1Result{}, nil
+		})
+	}()
+
+	<-started
+
+	// Fills the queue of the type waiting for the running check
+	go func() {
+		_, _ = pool.Do(context.Background(), "slow2", "slow", runCheckPoolResult)
+	}()
+
+	for {
+		queued, _ := pool.Stats()
+		if queued == 1 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	_, err := pool.Do(context.Background(), "slow3", "slow", runCheckPoolResult)
+	if err != errCheckQueueFull {
+		t.Fatalf("got error %v, want %v", err, errCheckQueueFull)
+	}
+
+	if pool.Health() == nil {
+		t.Errorf("got healthy pool with full queue")
+	}
+
+	// Other checker types are not affected
+	_, err = pool.Do(context.Background(), "other", "other", runCheckPoolResult)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	close(release)
+}
@@ -0,0 +1,325 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The state of checks which were not run for this time is dropped when
+// saving the state
+const checkStateMaxAge = 7 * 24 * time.Hour
+
+type checkStateContextKey struct{}
+
+type checkStateEntry struct {
+	UpdatedAt time.Time                     `json:"updated_at"`
+	Values    map[string]json.RawMessage    `json:"values"`
+	Counters  map[string]*checkStateCounter `json:"counters,omitempty"`
+}
+
+// checkStateStore keeps state of checks between their runs (e.g. read
+// positions or the previous values of counters), the state of each check is
+// identified by its check uid
+//
+// Values are always written to the state file, counters only if
+// persistCounters is set. Without filename the state is only kept in memory.
+type checkStateStore struct {
+	filename        string
+	persistCounters bool
+	mutex           sync.Mutex
+	entries         map[string]*checkStateEntry
+	changed         bool
+	// Set if a check read state not stored by a previous run
+	missing bool
+}
+
+// checkState is the state of a single check, a nil state stores nothing
+type checkState struct {
+	store *checkStateStore
+	key   string
+}
+
+// checkStateCounter is the value of a counter at the previous check
+type checkStateCounter struct {
+	Value uint64    `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// withCheckState returns a context passing the state to a checker
+func withCheckState(ctx context.Context, state *checkState) context.Context {
+	return context.WithValue(ctx, checkStateContextKey{}, state)
+}
+
+// checkStateFromContext returns the state of the running check or nil if
+// the check has none
+func checkStateFromContext(ctx context.Context) *checkState {
+	state, _ := ctx.Value(checkStateContextKey{}).(*checkState)
+
+	return state
+}
+
+// counterDelta returns the increase of a counter, a counter below its
+// previous value has either wrapped around or was reset
+//
+// A decrease of a value in the 32 bit range is treated as wrap, if the
+// resulting increase is below half of the range, otherwise as reset
+func counterDelta(prevValue uint64, value uint64) (uint64, bool) {
+	if value >= prevValue {
+		return value - prevValue, true
+	}
+
+	if prevValue <= math.MaxUint32 {
+		delta := math.MaxUint32 - prevValue + value + 1
+		if delta < math.MaxUint32/2 {
+			return delta, true
+		}
+	}
+
+	return 0, false
+}
+
+// entry returns the entry of a check, the caller must hold the mutex
+func (s *checkStateStore) entry(key string) *checkStateEntry {
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &checkStateEntry{}
+
+		s.entries[key] = entry
+	}
+
+	if entry.Values == nil {
+		entry.Values = map[string]json.RawMessage{}
+	}
+
+	if entry.Counters == nil {
+		entry.Counters = map[string]*checkStateCounter{}
+	}
+
+	entry.UpdatedAt = time.Now()
+
+	return entry
+}
+
+func (s *checkStateStore) get(key string, name string, value interface{}) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		s.missing = true
+
+		return false, nil
+	}
+
+	data, ok := entry.Values[name]
+	if !ok {
+		s.missing = true
+
+		return false, nil
+	}
+
+	err := json.Unmarshal(data, value)
+	if err != nil {
+		return false, fmt.Errorf("error decoding state '%s': %s", name, err)
+	}
+
+	return true, nil
+}
+
+func (s *checkStateStore) set(key string, name string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error encoding state '%s': %s", name, err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entry(key).Values[name] = data
+	s.changed = true
+
+	return nil
+}
+
+// swapCounter stores the value of a counter and returns the previous one
+func (s *checkStateStore) swapCounter(key string, name string, counter *checkStateCounter) *checkStateCounter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry := s.entry(key)
+
+	prevCounter := entry.Counters[name]
+	entry.Counters[name] = counter
+
+	if prevCounter == nil {
+		s.missing = true
+	}
+
+	if s.persistCounters {
+		s.changed = true
+	}
+
+	return prevCounter
+}
+
+// State returns the state of a check
+func (s *checkStateStore) State(key string) *checkState {
+	return &checkState{
+		store: s,
+		key:   key,
+	}
+}
+
+// Missing returns true if a check read state which was not stored by a
+// previous run, so the result of the check reflects only its baseline
+func (s *checkStateStore) Missing() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.missing
+}
+
+// Save drops the state of checks not run for checkStateMaxAge and writes
+// the state file if the state was changed since the last save
+func (s *checkStateStore) Save() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, entry := range s.entries {
+		if time.Since(entry.UpdatedAt) > checkStateMaxAge {
+			delete(s.entries, key)
+		}
+	}
+
+	if s.filename == "" || !s.changed {
+		return nil
+	}
+
+	entries := map[string]*checkStateEntry{}
+	for key, entry := range s.entries {
+		if !s.persistCounters {
+			entry = &checkStateEntry{
+				UpdatedAt: entry.UpdatedAt,
+				Values:    entry.Values,
+			}
+		}
+
+		entries[key] = entry
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("error encoding check state: %s", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.filename), 0700)
+	if err != nil {
+		return fmt.Errorf("error creating state dir: %s", err)
+	}
+
+	err = writeFileAtomic(s.filename, data, 0600)
+	if err != nil {
+		return fmt.Errorf("error writing check state: %s", err)
+	}
+
+	s.changed = false
+
+	return nil
+}
+
+// Get decodes the value stored for name into value, returning false if
+// there is none
+func (s *checkState) Get(name string, value interface{}) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+
+	return s.store.get(s.key, name, value)
+}
+
+// Set stores a value for the next run of the check
+func (s *checkState) Set(name string, value interface{}) error {
+	if s == nil {
+		return nil
+	}
+
+	return s.store.set(s.key, name, value)
+}
+
+// Delta stores the value of a counter and returns its increase and the
+// time passed since the previous run, returning false if there is no
+// previous value or the counter was reset
+func (s *checkState) Delta(name string, value uint64, now time.Time) (uint64, time.Duration, bool) {
+	if s == nil {
+		return 0, 0, false
+	}
+
+	prevCounter := s.store.swapCounter(s.key, name, &checkStateCounter{
+		Value: value,
+		Time:  now,
+	})
+
+	if prevCounter == nil || !now.After(prevCounter.Time) {
+		return 0, 0, false
+	}
+
+	delta, ok := counterDelta(prevCounter.Value, value)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return delta, now.Sub(prevCounter.Time), true
+}
+
+// Rate stores the value of a counter and returns its increase per second
+// since the previous run, returning false if there is no previous value or
+// the counter was reset
+func (s *checkState) Rate(name string, value uint64, now time.Time) (float64, bool) {
+	delta, elapsed, ok := s.Delta(name, value, now)
+	if !ok {
+		return 0, false
+	}
+
+	return float64(delta) / elapsed.Seconds(), true
+}
+
+// newCheckStateStore creates a store for the state of checks, loading the
+// stored state if filename is set
+func newCheckStateStore(filename string, persistCounters bool) (*checkStateStore, error) {
+	s := &checkStateStore{
+		filename:        filename,
+		persistCounters: persistCounters,
+		entries:         map[string]*checkStateEntry{},
+	}
+
+	if filename == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading check state: %s", err)
+	}
+	if err == nil {
+		entries := map[string]*checkStateEntry{}
+
+		err = json.Unmarshal(data, &entries)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding check state: %s", err)
+		}
+
+		for key, entry := range entries {
+			if entry != nil {
+				s.entries[key] = entry
+			}
+		}
+	}
+
+	return s, nil
+}
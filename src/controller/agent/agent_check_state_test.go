@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		prevValue uint64
+		value     uint64
+		wantDelta uint64
+		wantOK    bool
+	}{
+		{
+			name:      "unchanged",
+			prevValue: 100,
+			value:     100,
+			wantDelta: 0,
+			wantOK:    true,
+		},
+		{
+			name:      "increased",
+			prevValue: 100,
+			value:     250,
+			wantDelta: 150,
+			wantOK:    true,
+		},
+		{
+			name:      "32 bit wrap",
+			prevValue: math.MaxUint32 - 9,
+			value:     5,
+			wantDelta: 15,
+			wantOK:    true,
+		},
+		{
+			name:      "32 bit reset",
+			prevValue: math.MaxUint32 / 4,
+			value:     5,
+			wantOK:    false,
+		},
+		{
+			name:      "64 bit reset",
+			prevValue: math.MaxUint32 + 100,
+			value:     5,
+			wantOK:    false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delta, ok := counterDelta(test.prevValue, test.value)
+			if ok != test.wantOK {
+				t.Fatalf("got ok %v, want %v", ok, test.wantOK)
+			}
+
+			if ok && delta != test.wantDelta {
+				t.Errorf("got delta %d, want %d", delta, test.wantDelta)
+			}
+		})
+	}
+}
+
+func TestCheckStateRate(t *testing.T) {
+	store, err := newCheckStateStore("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := store.State("check")
+	now := time.Now()
+
+	_, ok := state.Rate("bytes", 1000, now)
+	if ok {
+		t.Errorf("got rate on first run")
+	}
+
+	rate, ok := state.Rate("bytes", 3000, now.Add(2*time.Second))
+	if !ok || rate != 1000 {
+		t.Errorf("got rate %f (%v), want 1000", rate, ok)
+	}
+
+	// Other checks have their own counters
+	_, ok = store.State("other").Rate("bytes", 5000, now.Add(4*time.Second))
+	if ok {
+		t.Errorf("got rate of other check on first run")
+	}
+}
+
+func TestCheckStateStoreMissing(t *testing.T) {
+	store, err := newCheckStateStore("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := store.State("check")
+
+	err = state.Set("offset", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var offset int
+
+	found, err := state.Get("offset", &offset)
+	if err != nil || !found || offset != 10 {
+		t.Fatalf("got offset %d (found %v, error %v), want 10", offset, found, err)
+	}
+
+	if store.Missing() {
+		t.Errorf("got missing state after reading stored state")
+	}
+
+	state.Rate("rx_bytes", 100, time.Now())
+
+	if !store.Missing() {
+		t.Errorf("got no missing state after first counter")
+	}
+}
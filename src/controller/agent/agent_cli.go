@@ -0,0 +1,359 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/indece-official/go-gousu/v2/gousu/logger"
+	"github.com/indece-official/monitor-agent-linux/src/buildvars"
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/namsral/flag"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	OutputFormatText = "text"
+	OutputFormatJSON = "json"
+)
+
+// Max. time to wait for a timed out checker before exiting
+const cliAbandonedTimeout = 10 * time.Second
+
+var (
+	outputFormat = flag.String("format", OutputFormatText, "")
+)
+
+// newCLIController parses the flags and creates a controller with all
+// checkers and local checks, but without connection to the server
+func newCLIController(args []string) (*Controller, []string, error) {
+	flag.String(flag.DefaultConfigFlagname, "", "Path to config file")
+
+	err := flag.CommandLine.Parse(args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if *outputFormat != OutputFormatText && *outputFormat != OutputFormatJSON {
+		return nil, nil, fmt.Errorf("invalid format '%s'", *outputFormat)
+	}
+
+	// Logs are written to stdout, which is reserved for the output
+	logger.DisableLogger()
+	logger.InitLogger(buildvars.ProjectName)
+
+	c := &Controller{
+		log: logger.GetLogger("cli"),
+	}
+
+	// The agent checker is only available if a client certificate is configured
+	clientCrtLoader, err := newClientCrtLoader(
+		*serverClientCrtFile,
+		*serverClientKeyFile,
+		*serverClientCrt,
+		*serverClientKey,
+	)
+	if err == nil {
+		c.clientCrtLoader = clientCrtLoader
+	}
+
+	c.checkFilter, err = newCheckFilter(*disabledCheckers, *excludedChecks, *checkParamOverrides)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing check filter: %s", err)
+	}
+
+	// The state of checks is only kept in memory, so runs of the CLI don't
+	// change the state of the running agent
+	c.checkStates, err = newCheckStateStore("", false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.addCheckers()
+	c.addPluginCheckers()
+
+	localChecks, commands, err := c.loadLocalChecks()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error loading local checks: %s", err)
+	}
+
+	c.setLocalChecks(localChecks, commands)
+
+	c.metrics = newAgentMetrics(c)
+
+	return c, flag.CommandLine.Args(), nil
+}
+
+func printJSON(data interface{}) error {
+	dataJSON, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(dataJSON))
+
+	return nil
+}
+
+func sortedCheckerTypes(checkers map[string]IChecker) []string {
+	checkerTypes := []string{}
+	for checkerType := range checkers {
+		checkerTypes = append(checkerTypes, checkerType)
+	}
+
+	sort.Strings(checkerTypes)
+
+	return checkerTypes
+}
+
+func formatCheckValue(value *apiagent.CheckV1Value) string {
+	if value.Unit == "" {
+		return value.Value
+	}
+
+	return fmt.Sprintf("%s %s", value.Value, value.Unit)
+}
+
+// checkExitCode returns the exit code for a status following the
+// conventions of nagios plugins
+func checkExitCode(status apiagent.CheckV1Status) int {
+	switch status {
+	case apiagent.CheckV1Status_CheckV1StatusOK:
+		return 0
+	case apiagent.CheckV1Status_CheckV1StatusWarning:
+		return 1
+	case apiagent.CheckV1Status_CheckV1StatusCritical:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// RunCheck runs the check command: it runs a checker once with the params
+// given as key=value and prints the result, the exit code reflects the status
+func RunCheck(args []string) (int, error) {
+	c, args, err := newCLIController(args)
+	if err != nil {
+		return 3, err
+	}
+
+	if len(args) < 1 {
+		return 3, fmt.Errorf("missing checker type, usage: check [flags] <checker-type> [key=value ...]")
+	}
+
+	checker, ok := c.findChecker(args[0])
+	if !ok {
+		return 3, fmt.Errorf("unknown checker type '%s'", args[0])
+	}
+
+	reqChecker, err := checker.GetChecker()
+	if err != nil {
+		return 3, fmt.Errorf("error loading checker %s: %s", checker.GetType(), err)
+	}
+
+	params := []*apiagent.CheckV1Param{}
+	for _, arg := range args[1:] {
+		argParts := strings.SplitN(arg, "=", 2)
+		if len(argParts) != 2 {
+			return 3, fmt.Errorf("invalid parameter '%s': must have format key=value", arg)
+		}
+
+		params = append(params, &apiagent.CheckV1Param{
+			Name:  argParts[0],
+			Value: argParts[1],
+		})
+	}
+
+	checkerParams, _, err := splitThresholdParams(reqChecker, params)
+	if err != nil {
+		return 3, err
+	}
+
+	_, err = parseCheckParams(reqChecker, checkerParams)
+	if err != nil {
+		return 3, err
+	}
+
+	checkResult, abandoned := c.check(context.Background(), checker.GetType(), &apiagent.CheckV1Request{
+		CheckerType: checker.GetType(),
+		Params:      params,
+	})
+
+	if abandoned != nil {
+		// Give the timed out checker time to stop its child processes
+		select {
+		case <-abandoned:
+		case <-time.After(cliAbandonedTimeout):
+			fmt.Fprintf(os.Stderr, "Warning: checker still running %s after the timeout\n", cliAbandonedTimeout)
+		}
+	}
+
+	// The state is only kept in memory, so stateful checkers (e.g. logfile,
+	// netif) have no previous run to compare with
+	if checkResult.Error == "" && c.checkStates.Missing() {
+		checkResult.Status = apiagent.CheckV1Status_CheckV1StatusUnknown
+		checkResult.Message = fmt.Sprintf(
+			"First run, no baseline: the checker compares with the previous run, which the check command doesn't keep\n%s",
+			checkResult.Message,
+		)
+	}
+
+	if *outputFormat == OutputFormatJSON {
+		dataJSON, err := protojson.MarshalOptions{Multiline: true}.Marshal(checkResult)
+		if err != nil {
+			return 3, fmt.Errorf("error encoding result: %s", err)
+		}
+
+		fmt.Println(string(dataJSON))
+
+		return checkExitCode(checkResult.Status), nil
+	}
+
+	fmt.Printf("Status:   %s\n", strings.TrimPrefix(checkResult.Status.String(), "CheckV1Status"))
+	fmt.Printf("Message:  %s\n", strings.TrimRight(checkResult.Message, "\n"))
+	if checkResult.Error != "" {
+		fmt.Printf("Error:    %s\n", checkResult.Error)
+	}
+	if checkResult.Duration != nil {
+		fmt.Printf("Duration: %s\n", checkResult.Duration.AsDuration())
+	}
+
+	if len(checkResult.Values) > 0 {
+		fmt.Printf("Values:\n")
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, value := range checkResult.Values {
+			fmt.Fprintf(writer, "  %s\t%s\n", value.Name, formatCheckValue(value))
+		}
+		writer.Flush()
+	}
+
+	return checkExitCode(checkResult.Status), nil
+}
+
+// ListCheckers runs the list-checkers command printing all available
+// checkers with their params and values
+func ListCheckers(args []string) error {
+	c, _, err := newCLIController(args)
+	if err != nil {
+		return err
+	}
+
+	reqCheckers := []*apiagent.CheckerV1{}
+
+	for _, checkerType := range sortedCheckerTypes(c.checkers) {
+		reqChecker, err := c.checkers[checkerType].GetChecker()
+		if err != nil {
+			return fmt.Errorf("error loading checker %s: %s", checkerType, err)
+		}
+
+		reqCheckers = append(reqCheckers, reqChecker)
+	}
+
+	if *outputFormat == OutputFormatJSON {
+		checkers := []json.RawMessage{}
+
+		for _, reqChecker := range reqCheckers {
+			data, err := protojson.Marshal(reqChecker)
+			if err != nil {
+				return fmt.Errorf("error encoding checker %s: %s", reqChecker.Type, err)
+			}
+
+			checkers = append(checkers, data)
+		}
+
+		return printJSON(checkers)
+	}
+
+	for i, reqChecker := range reqCheckers {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		fmt.Printf("%s (%s)\n", reqChecker.Type, reqChecker.Name)
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+		for _, checkerParam := range reqChecker.Params {
+			required := ""
+			if checkerParam.Required {
+				required = "required"
+			}
+
+			fmt.Fprintf(
+				writer,
+				"  param\t%s\t%s\t%s\t%s\n",
+				checkerParam.Name,
+				strings.TrimPrefix(checkerParam.Type.String(), "CheckerV1ParamType"),
+				required,
+				checkerParam.Label,
+			)
+		}
+
+		for _, checkerValue := range reqChecker.Values {
+			fmt.Fprintf(
+				writer,
+				"  value\t%s\t%s\n",
+				checkerValue.Name,
+				strings.TrimPrefix(checkerValue.Type.String(), "CheckerV1ValueType"),
+			)
+		}
+
+		writer.Flush()
+	}
+
+	return nil
+}
+
+// ListChecks runs the list-checks command printing the autodiscovered
+// checks of all checkers and the checks defined in local config files
+func ListChecks(args []string) error {
+	c, _, err := newCLIController(args)
+	if err != nil {
+		return err
+	}
+
+	checks := c.localScheduledChecks()
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].key() < checks[j].key()
+	})
+
+	for _, check := range checks {
+		check.Params = c.maskParams(check.CheckerType, check.Params)
+	}
+
+	if *outputFormat == OutputFormatJSON {
+		return printJSON(checks)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(writer, "TYPE\tNAME\tCHECKER\tSCHEDULE\tPARAMS\n")
+
+	for _, check := range checks {
+		params := []string{}
+		for name, value := range check.Params {
+			params = append(params, fmt.Sprintf("%s=%s", name, value))
+		}
+
+		sort.Strings(params)
+
+		fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t%s\t%s\n",
+			check.CheckType,
+			check.Name,
+			checkerShortType(check.CheckerType),
+			check.Schedule,
+			strings.Join(params, " "),
+		)
+	}
+
+	return writer.Flush()
+}
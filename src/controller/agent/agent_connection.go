@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// watchConnection tracks the state of the grpc connection and counts how often
+// it got ready, so reconnects (e.g. after a server restart) can be detected
+func (c *Controller) watchConnection() {
+	state := c.grpcConn.GetState()
+
+	for {
+		c.mutexConnState.Lock()
+		if state == connectivity.Ready && c.connState != connectivity.Ready {
+			c.connGeneration++
+
+			if c.connGeneration > 1 {
+				c.metrics.streamReconnects.Inc()
+			}
+		}
+		c.connState = state
+		close(c.connStateChanged)
+		c.connStateChanged = make(chan struct{})
+		c.mutexConnState.Unlock()
+
+		if state == connectivity.Shutdown {
+			return
+		}
+
+		if state == connectivity.Idle {
+			c.grpcConn.Connect()
+		}
+
+		if !c.grpcConn.WaitForStateChange(context.Background(), state) {
+			return
+		}
+
+		state = c.grpcConn.GetState()
+	}
+}
+
+// awaitConnection waits until the connection to the server is ready and
+// returns the number of times it got ready so far
+func (c *Controller) awaitConnection(ctx context.Context) (uint64, error) {
+	for {
+		c.mutexConnState.Lock()
+		state := c.connState
+		generation := c.connGeneration
+		changed := c.connStateChanged
+		c.mutexConnState.Unlock()
+
+		switch state {
+		case connectivity.Ready:
+			return generation, nil
+		case connectivity.Shutdown:
+			return 0, fmt.Errorf("connection closed")
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
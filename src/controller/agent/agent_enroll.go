@@ -0,0 +1,269 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/buildvars"
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/namsral/flag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var (
+	enrollToken   = flag.String("enroll_token", "", "")
+	enrollDir     = flag.String("enroll_dir", "/etc/indece-monitor", "")
+	enrollTimeout = flag.Duration("enroll_timeout", 30*time.Second, "")
+)
+
+// writeFileAtomic writes a file via a temporary file, so the file is never
+// left partially written
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	err := os.WriteFile(filename+".tmp", data, perm)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(filename+".tmp", filename)
+}
+
+// updateConfigFile sets the given keys in a config file, keeping all
+// other lines as they are
+func updateConfigFile(filename string, values map[string]string, keys []string) error {
+	lines := []string{}
+
+	file, err := os.Open(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error opening config file: %s", err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+
+		file.Close()
+
+		if scanner.Err() != nil {
+			return fmt.Errorf("error reading config file: %s", scanner.Err())
+		}
+	}
+
+	written := map[string]bool{}
+
+	for i, line := range lines {
+		lineParts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		key := strings.TrimSpace(lineParts[0])
+
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+
+		lines[i] = fmt.Sprintf("%s=%s", key, value)
+		written[key] = true
+	}
+
+	for _, key := range keys {
+		if !written[key] {
+			lines = append(lines, fmt.Sprintf("%s=%s", key, values[key]))
+		}
+	}
+
+	err = writeFileAtomic(filename, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	if err != nil {
+		return fmt.Errorf("error writing config file: %s", err)
+	}
+
+	return nil
+}
+
+// enrollKey generates the private key of the client certificate, returning
+// it also PEM encoded
+func enrollKey() (*ecdsa.PrivateKey, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating private key: %s", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error encoding private key: %s", err)
+	}
+
+	return key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+func enrollCSR(key *ecdsa.PrivateKey, hostname string) ([]byte, error) {
+	csrDER, err := x509.CreateCertificateRequest(
+		rand.Reader,
+		&x509.CertificateRequest{
+			Subject: pkix.Name{
+				CommonName: hostname,
+			},
+			DNSNames: []string{hostname},
+		},
+		key,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER}), nil
+}
+
+func enrollRequest(req *apiagent.EnrollV1Request) (*apiagent.EnrollV1Response, error) {
+	tlsConfig := &tls.Config{}
+
+	// Without configured ca the server certificate is verified against the system roots
+	if *serverCACrtFile != "" || *serverCACrt != "" {
+		caCrtRaw, err := loadPEM("ca crt", *serverCACrtFile, *serverCACrt)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCrtRaw) {
+			return nil, fmt.Errorf("credentials: failed to append certificates")
+		}
+	}
+
+	grpcConn, err := grpc.Dial(
+		fmt.Sprintf("%s:%d", *serverHost, *serverPort),
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"connecting to grpc server on %s:%d failed: %s",
+			*serverHost,
+			*serverPort,
+			err,
+		)
+	}
+	defer grpcConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *enrollTimeout)
+	defer cancel()
+
+	return apiagent.NewAgentClient(grpcConn).EnrollV1(ctx, req)
+}
+
+// Enroll runs the enroll command: it generates a private key, requests a
+// client certificate for it with a one-time token and writes the certificates
+// and the resulting config
+func Enroll(args []string) error {
+	flag.String(flag.DefaultConfigFlagname, "", "Path to config file")
+
+	err := flag.CommandLine.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	configFilename := flag.Lookup(flag.DefaultConfigFlagname).Value.String()
+	if configFilename == "" {
+		return fmt.Errorf("missing parameter 'config'")
+	}
+
+	if *enrollToken == "" {
+		return fmt.Errorf("missing parameter 'enroll_token'")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("error loading hostname: %s", err)
+	}
+
+	key, keyPEM, err := enrollKey()
+	if err != nil {
+		return err
+	}
+
+	csrPEM, err := enrollCSR(key, hostname)
+	if err != nil {
+		return fmt.Errorf("error creating certificate request: %s", err)
+	}
+
+	resp, err := enrollRequest(&apiagent.EnrollV1Request{
+		Token:    *enrollToken,
+		Csr:      string(csrPEM),
+		Type:     "com.indece.agent.linux.v1",
+		Version:  buildvars.BuildVersion,
+		Hostname: hostname,
+	})
+	if err != nil {
+		return fmt.Errorf("error enrolling agent: %s", err)
+	}
+
+	_, err = tls.X509KeyPair([]byte(resp.ClientCrt), keyPEM)
+	if err != nil {
+		return fmt.Errorf("received invalid client certificate: %s", err)
+	}
+
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(resp.CaCrt)) {
+		return fmt.Errorf("received invalid ca certificate")
+	}
+
+	err = os.MkdirAll(*enrollDir, 0755)
+	if err != nil {
+		return fmt.Errorf("error creating directory %s: %s", *enrollDir, err)
+	}
+
+	caCrtFilename := filepath.Join(*enrollDir, "ca.crt")
+	clientCrtFilename := filepath.Join(*enrollDir, "client.crt")
+	clientKeyFilename := filepath.Join(*enrollDir, "client.key")
+
+	err = writeFileAtomic(clientKeyFilename, keyPEM, 0600)
+	if err != nil {
+		return fmt.Errorf("error writing client key: %s", err)
+	}
+
+	err = writeFileAtomic(clientCrtFilename, []byte(resp.ClientCrt), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing client certificate: %s", err)
+	}
+
+	err = writeFileAtomic(caCrtFilename, []byte(resp.CaCrt), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing ca certificate: %s", err)
+	}
+
+	configKeys := []string{
+		"server_host",
+		"server_port",
+		"ca_crt_file",
+		"client_crt_file",
+		"client_key_file",
+	}
+
+	err = updateConfigFile(
+		configFilename,
+		map[string]string{
+			"server_host":     *serverHost,
+			"server_port":     fmt.Sprintf("%d", *serverPort),
+			"ca_crt_file":     caCrtFilename,
+			"client_crt_file": clientCrtFilename,
+			"client_key_file": clientKeyFilename,
+		},
+		configKeys,
+	)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Enrolled agent %s, config written to %s\n", hostname, configFilename)
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		values  map[string]string
+		keys    []string
+		want    string
+	}{
+		{
+			name:   "new file",
+			values: map[string]string{"client_crt_file": "/etc/a.crt", "client_key_file": "/etc/a.key"},
+			keys:   []string{"client_crt_file", "client_key_file"},
+			want:   "client_crt_file=/etc/a.crt\nclient_key_file=/etc/a.key\n",
+		},
+		{
+			name:    "replace existing keys",
+			content: "server_host=myserver\nclient_crt_file = /old.crt\nclient_key_file=/old.key\n",
+			values:  map[string]string{"client_crt_file": "/etc/a.crt", "client_key_file": "/etc/a.key"},
+			keys:    []string{"client_crt_file", "client_key_file"},
+			want:    "server_host=myserver\nclient_crt_file=/etc/a.crt\nclient_key_file=/etc/a.key\n",
+		},
+		{
+			name:    "keep unrelated lines and append missing keys",
+			content: "# comment\nserver_host=myserver\n\n#client_crt_file=/etc/x.crt\nclient_crt_file=/old.crt\n",
+			values:  map[string]string{"client_crt_file": "/etc/a.crt", "client_key_file": "/etc/a.key"},
+			keys:    []string{"client_crt_file", "client_key_file"},
+			want:    "# comment\nserver_host=myserver\n\n#client_crt_file=/etc/x.crt\nclient_crt_file=/etc/a.crt\nclient_key_file=/etc/a.key\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "agent-linux.conf")
+
+			if test.content != "" {
+				err := os.WriteFile(filename, []byte(test.content), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := updateConfigFile(filename, test.values, test.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != test.want {
+				t.Errorf("got %q, want %q", data, test.want)
+			}
+		})
+	}
+}
+
+func TestEnrollKeyAndCSR(t *testing.T) {
+	key, keyPEM, err := enrollKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil || keyBlock.Type != "EC PRIVATE KEY" {
+		t.Fatalf("got invalid key pem %q", keyPEM)
+	}
+
+	parsedKey, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !parsedKey.Equal(key) {
+		t.Errorf("got pem of other key")
+	}
+
+	csrPEM, err := enrollCSR(key, "host.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csrBlock, _ := pem.Decode(csrPEM)
+	if csrBlock == nil || csrBlock.Type != "CERTIFICATE REQUEST" {
+		t.Fatalf("got invalid csr pem %q", csrPEM)
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = csr.CheckSignature()
+	if err != nil {
+		t.Errorf("got invalid csr signature: %s", err)
+	}
+
+	if csr.Subject.CommonName != "host.example.com" {
+		t.Errorf("got common name %s, want host.example.com", csr.Subject.CommonName)
+	}
+
+	if !reflect.DeepEqual(csr.DNSNames, []string{"host.example.com"}) {
+		t.Errorf("got dns names %v, want [host.example.com]", csr.DNSNames)
+	}
+
+	publicKey, ok := csr.PublicKey.(*ecdsa.PublicKey)
+	if !ok || !publicKey.Equal(&key.PublicKey) {
+		t.Errorf("got csr for other key")
+	}
+}
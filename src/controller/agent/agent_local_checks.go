@@ -0,0 +1,331 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"google.golang.org/grpc/connectivity"
+	"gopkg.in/yaml.v3"
+)
+
+// localCheckConfig is a check defined in a local config file
+type localCheckConfig struct {
+	ID       string            `yaml:"id"`
+	Name     string            `yaml:"name"`
+	Checker  string            `yaml:"checker"`
+	Schedule string            `yaml:"schedule"`
+	Timeout  string            `yaml:"timeout"`
+	Params   map[string]string `yaml:"params"`
+}
+
+// localCommandConfig is an allowed command for the nagios checker
+type localCommandConfig struct {
+	Command []string `yaml:"command"`
+}
+
+// localConfig is the content of a local config file (yaml or json)
+type localConfig struct {
+	Commands map[string]*localCommandConfig `yaml:"commands"`
+	Checks   []*localCheckConfig            `yaml:"checks"`
+}
+
+// localConfigFilenames returns the checks file and all yaml/json files
+// in the checks directory
+func localConfigFilenames(checksFilename string, checksDirname string) ([]string, error) {
+	filenames := []string{}
+
+	if checksFilename != "" {
+		filenames = append(filenames, checksFilename)
+	}
+
+	if checksDirname == "" {
+		return filenames, nil
+	}
+
+	entries, err := os.ReadDir(checksDirname)
+	if os.IsNotExist(err) {
+		return filenames, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading directory %s: %s", checksDirname, err)
+	}
+
+	dirFilenames := []string{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		switch filepath.Ext(entry.Name()) {
+		case ".yml", ".yaml", ".json":
+			dirFilenames = append(dirFilenames, filepath.Join(checksDirname, entry.Name()))
+		}
+	}
+
+	sort.Strings(dirFilenames)
+
+	return append(filenames, dirFilenames...), nil
+}
+
+func loadLocalConfig(filename string) (*localConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", filename, err)
+	}
+
+	config := &localConfig{}
+
+	// Json is a subset of yaml, so both are parsed by the yaml decoder
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s: %s", filename, err)
+	}
+
+	return config, nil
+}
+
+// findChecker returns the checker with the given full or short type
+func (c *Controller) findChecker(checkerType string) (IChecker, bool) {
+	if checker, ok := c.checkers[checkerType]; ok {
+		return checker, true
+	}
+
+	for _, checker := range c.checkers {
+		if checkerShortType(checker.GetType()) == checkerType {
+			return checker, true
+		}
+	}
+
+	return nil, false
+}
+
+func (c *Controller) localCheckFromConfig(checkConfig *localCheckConfig, commands map[string][]string) (*apiagent.CheckV1, error) {
+	if checkConfig.ID == "" {
+		return nil, fmt.Errorf("missing id")
+	}
+
+	checker, ok := c.findChecker(checkConfig.Checker)
+	if !ok {
+		return nil, fmt.Errorf("unknown checker '%s'", checkConfig.Checker)
+	}
+
+	if checker.GetType() == CheckerTypeNagios {
+		// Validate against the loaded commands, the running nagios checker
+		// keeps the previous ones until the whole config is loaded
+		nagiosChecker := NewNagiosChecker()
+		nagiosChecker.SetCommands(commands)
+
+		checker = nagiosChecker
+	}
+
+	reqChecker, err := checker.GetChecker()
+	if err != nil {
+		return nil, fmt.Errorf("error loading checker %s: %s", checker.GetType(), err)
+	}
+
+	if checkConfig.Schedule != "" {
+		_, err = newCronParser().Parse(checkConfig.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule '%s': %s", checkConfig.Schedule, err)
+		}
+	}
+
+	if checkConfig.Timeout != "" {
+		_, err = time.ParseDuration(checkConfig.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout '%s': %s", checkConfig.Timeout, err)
+		}
+	}
+
+	paramNames := []string{}
+	for name := range checkConfig.Params {
+		paramNames = append(paramNames, name)
+	}
+
+	sort.Strings(paramNames)
+
+	params := []*apiagent.CheckV1Param{}
+	for _, name := range paramNames {
+		params = append(params, &apiagent.CheckV1Param{
+			Name:  name,
+			Value: checkConfig.Params[name],
+		})
+	}
+
+	checkerParams, _, err := splitThresholdParams(reqChecker, params)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = parseCheckParams(reqChecker, checkerParams)
+	if err != nil {
+		return nil, err
+	}
+
+	name := checkConfig.Name
+	if name == "" {
+		name = checkConfig.ID
+	}
+
+	return &apiagent.CheckV1{
+		Name:        name,
+		Type:        fmt.Sprintf("%s:local:%s", checker.GetType(), checkConfig.ID),
+		CheckerType: checker.GetType(),
+		Schedule:    checkConfig.Schedule,
+		Timeout:     checkConfig.Timeout,
+		Params:      params,
+	}, nil
+}
+
+// loadLocalChecks loads and validates all checks and allowed commands of the
+// nagios checker defined in local config files
+func (c *Controller) loadLocalChecks() ([]*apiagent.CheckV1, map[string][]string, error) {
+	filenames, err := localConfigFilenames(*localChecksFile, *localChecksDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configs := map[string]*localConfig{}
+	commands := map[string][]string{}
+	commandFilenames := map[string]string{}
+
+	for _, filename := range filenames {
+		config, err := loadLocalConfig(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		configs[filename] = config
+
+		for name, commandConfig := range config.Commands {
+			if otherFilename, ok := commandFilenames[name]; ok {
+				return nil, nil, fmt.Errorf("error in command '%s' in %s: name already used in %s", name, filename, otherFilename)
+			}
+
+			if commandConfig == nil || len(commandConfig.Command) == 0 {
+				return nil, nil, fmt.Errorf("error in command '%s' in %s: missing command", name, filename)
+			}
+
+			commandFilenames[name] = filename
+			commands[name] = commandConfig.Command
+		}
+	}
+
+	checks := []*apiagent.CheckV1{}
+	ids := map[string]string{}
+
+	for _, filename := range filenames {
+		config := configs[filename]
+
+		for i, checkConfig := range config.Checks {
+			if otherFilename, ok := ids[checkConfig.ID]; ok && checkConfig.ID != "" {
+				return nil, nil, fmt.Errorf("error in check '%s' in %s: id already used in %s", checkConfig.ID, filename, otherFilename)
+			}
+
+			ids[checkConfig.ID] = filename
+
+			check, err := c.localCheckFromConfig(checkConfig, commands)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error in check #%d ('%s') in %s: %s", i+1, checkConfig.ID, filename, err)
+			}
+
+			checks = append(checks, check)
+		}
+	}
+
+	return checks, commands, nil
+}
+
+// setLocalChecks sets the local checks and the allowed commands of the
+// nagios checker loaded by loadLocalChecks
+func (c *Controller) setLocalChecks(checks []*apiagent.CheckV1, commands map[string][]string) {
+	c.nagiosChecker.SetCommands(commands)
+
+	c.mutexLocalChecks.Lock()
+	c.localChecks = checks
+	c.mutexLocalChecks.Unlock()
+}
+
+// getLocalChecks returns the checks defined in local config files
+func (c *Controller) getLocalChecks() []*apiagent.CheckV1 {
+	c.mutexLocalChecks.Lock()
+	defer c.mutexLocalChecks.Unlock()
+
+	return c.localChecks
+}
+
+// reloadLocalChecks loads the local checks, schedules them and registers
+// them at the server if connected
+func (c *Controller) reloadLocalChecks(ctx context.Context) error {
+	checks, commands, err := c.loadLocalChecks()
+	if err != nil {
+		return err
+	}
+
+	c.setLocalChecks(checks, commands)
+
+	c.log.Infof("Loaded %d local checks", len(checks))
+
+	if c.scheduler != nil {
+		err = c.scheduler.SetLocalChecks(c.localScheduledChecks())
+		if err != nil {
+			return fmt.Errorf("error scheduling local checks: %s", err)
+		}
+	}
+
+	c.mutexConnState.Lock()
+	connected := c.connState == connectivity.Ready
+	c.mutexConnState.Unlock()
+
+	// Without connection the checks get registered after connecting
+	if !connected {
+		return nil
+	}
+
+	// The allowed commands are part of the nagios checker registration,
+	// unless the nagios checker is disabled
+	if _, ok := c.checkers[CheckerTypeNagios]; ok {
+		err = c.registerChecker(ctx, c.nagiosChecker)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, check := range checks {
+		err = c.registerCheck(ctx, check)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// localChecksReloadLoop reloads the local checks on SIGHUP
+func (c *Controller) localChecksReloadLoop(ctx context.Context) {
+	chanSignal := make(chan os.Signal, 1)
+	signal.Notify(chanSignal, syscall.SIGHUP)
+	defer signal.Stop(chanSignal)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-chanSignal:
+			c.log.Infof("Reloading local checks")
+
+			err := c.reloadLocalChecks(ctx)
+			if err != nil {
+				c.log.Errorf("Error reloading local checks: %s", err)
+			}
+		}
+	}
+}
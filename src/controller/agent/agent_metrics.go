@@ -0,0 +1,323 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "indece_monitor_agent"
+
+var metricsInvalidLabelChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+var metricsCheckLabels = []string{"check", "check_uid", "check_type", "checker_type"}
+
+var (
+	metricsDescCheckStatus = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "check", "status"),
+		"Status of the latest check result (0=ok, 1=warning, 2=critical, 3=unknown)",
+		metricsCheckLabels,
+		nil,
+	)
+	metricsDescCheckMeasuredAt = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "check", "measured_timestamp_seconds"),
+		"Time of the latest check result",
+		metricsCheckLabels,
+		nil,
+	)
+	metricsDescCheckValue = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "check", "value"),
+		"Latest numeric values of the check",
+		append(append([]string{}, metricsCheckLabels...), "value", "unit"),
+		nil,
+	)
+)
+
+// agentMetrics contains the self-metrics of the agent
+type agentMetrics struct {
+	registry         *prometheus.Registry
+	streamReconnects prometheus.Counter
+	checkDuration    *prometheus.HistogramVec
+	checkFailures    *prometheus.CounterVec
+}
+
+// resultCollector exports the latest check results as metrics
+//
+// The labels of check_info depend on the params of all checks, so the
+// collector is unchecked
+type resultCollector struct {
+	controller *Controller
+}
+
+func (r *resultCollector) Describe(chan<- *prometheus.Desc) {
+}
+
+// checkValueMetric returns the numeric value of a check value, durations
+// are converted to seconds and timestamps to unix time
+func checkValueMetric(value *apiagent.CheckV1Value) (float64, bool) {
+	switch typedValue := value.TypedValue.(type) {
+	case *apiagent.CheckV1Value_DoubleValue:
+		return typedValue.DoubleValue, true
+	case *apiagent.CheckV1Value_IntValue:
+		return float64(typedValue.IntValue), true
+	case *apiagent.CheckV1Value_BoolValue:
+		if typedValue.BoolValue {
+			return 1, true
+		}
+
+		return 0, true
+	case *apiagent.CheckV1Value_DurationValue:
+		return typedValue.DurationValue.AsDuration().Seconds(), true
+	case *apiagent.CheckV1Value_TimestampValue:
+		return float64(typedValue.TimestampValue.AsTime().UnixNano()) / float64(time.Second), true
+	default:
+		return 0, false
+	}
+}
+
+// paramLabels returns the params of a check by label name, skipping
+// passwords and threshold overrides
+func (r *resultCollector) paramLabels(entry *resultEntry) map[string]string {
+	hiddenParams := r.controller.hiddenParams(entry.CheckerType)
+
+	labels := map[string]string{}
+
+	for _, param := range entry.Params {
+		if hiddenParams[param.Name] || strings.HasPrefix(param.Name, thresholdParamPrefix) {
+			continue
+		}
+
+		name := "param_" + metricsInvalidLabelChars.ReplaceAllString(param.Name, "_")
+		if _, ok := labels[name]; ok {
+			continue
+		}
+
+		labels[name] = param.Value
+	}
+
+	return labels
+}
+
+// Collect skips metrics with the same labels as an already collected one
+// (e.g. checks with the same name or values with the same name), which the
+// registry would reject
+//
+// The params of the checks are exported as check_info with the params of all
+// checks as labels, as all metrics with the same name need the same labels
+func (r *resultCollector) Collect(ch chan<- prometheus.Metric) {
+	collected := map[string]bool{}
+	entriesLabelValues := [][]string{}
+	entriesParamLabels := []map[string]string{}
+	usedParamNames := map[string]bool{}
+
+	for _, entry := range r.controller.results.List() {
+		name := entry.Name
+		if name == "" {
+			name = entry.Key
+		}
+
+		labelValues := []string{name, entry.CheckUID, entry.CheckType, entry.CheckerType}
+
+		key := strings.Join(labelValues, "\xff")
+		if collected[key] {
+			continue
+		}
+
+		collected[key] = true
+
+		paramLabels := r.paramLabels(entry)
+		for paramName := range paramLabels {
+			usedParamNames[paramName] = true
+		}
+
+		entriesLabelValues = append(entriesLabelValues, labelValues)
+		entriesParamLabels = append(entriesParamLabels, paramLabels)
+
+		ch <- prometheus.MustNewConstMetric(
+			metricsDescCheckStatus,
+			prometheus.GaugeValue,
+			float64(entry.Result.Status),
+			labelValues...,
+		)
+
+		if entry.Result.MeasuredAt != nil {
+			ch <- prometheus.MustNewConstMetric(
+				metricsDescCheckMeasuredAt,
+				prometheus.GaugeValue,
+				float64(entry.Result.MeasuredAt.AsTime().Unix()),
+				labelValues...,
+			)
+		}
+
+		for _, value := range entry.Result.Values {
+			metricValue, ok := checkValueMetric(value)
+			if !ok {
+				continue
+			}
+
+			valueKey := strings.Join([]string{key, value.Name, value.Unit}, "\xff")
+			if collected[valueKey] {
+				continue
+			}
+
+			collected[valueKey] = true
+
+			ch <- prometheus.MustNewConstMetric(
+				metricsDescCheckValue,
+				prometheus.GaugeValue,
+				metricValue,
+				append(append([]string{}, labelValues...), value.Name, value.Unit)...,
+			)
+		}
+	}
+
+	paramNames := []string{}
+	for paramName := range usedParamNames {
+		paramNames = append(paramNames, paramName)
+	}
+
+	sort.Strings(paramNames)
+
+	descInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "check", "info"),
+		"Params of the check",
+		append(append([]string{}, metricsCheckLabels...), paramNames...),
+		nil,
+	)
+
+	for i := range entriesLabelValues {
+		labelValues := append([]string{}, entriesLabelValues[i]...)
+		for _, paramName := range paramNames {
+			labelValues = append(labelValues, entriesParamLabels[i][paramName])
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			descInfo,
+			prometheus.GaugeValue,
+			1,
+			labelValues...,
+		)
+	}
+}
+
+var _ prometheus.Collector = (*resultCollector)(nil)
+
+// observeCheck records the duration and failure of a check
+func (m *agentMetrics) observeCheck(checkerType string, duration time.Duration, checkResult *apiagent.CheckV1Result) {
+	m.checkDuration.WithLabelValues(checkerType).Observe(duration.Seconds())
+
+	if checkResult.Error != "" {
+		m.checkFailures.WithLabelValues(checkerType).Inc()
+	}
+}
+
+func newAgentMetrics(c *Controller) *agentMetrics {
+	m := &agentMetrics{
+		registry: prometheus.NewRegistry(),
+		streamReconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "stream_reconnects_total",
+			Help:      "Number of reconnects to the server",
+		}),
+		checkDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "check_duration_seconds",
+			Help:      "Duration of checks",
+			Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60},
+		}, []string{"checker_type"}),
+		checkFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "check_failures_total",
+			Help:      "Number of failed checks",
+		}, []string{"checker_type"}),
+	}
+
+	m.registry.MustRegister(
+		m.streamReconnects,
+		m.checkDuration,
+		m.checkFailures,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "checks_queued",
+			Help:      "Number of checks waiting for a free slot",
+		}, func() float64 {
+			queued, _ := c.checkPool.Stats()
+
+			return float64(queued)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "checks_running",
+			Help:      "Number of running checks",
+		}, func() float64 {
+			_, running := c.checkPool.Stats()
+
+			return float64(running)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "spool_results",
+			Help:      "Number of results in the spool",
+		}, func() float64 {
+			return float64(c.spool.Len())
+		}),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		&resultCollector{controller: c},
+	)
+
+	return m
+}
+
+// startMetricsServer starts the http listener for the /metrics endpoint
+func (c *Controller) startMetricsServer() error {
+	listener, err := net.Listen("tcp", *metricsListen)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %s", *metricsListen, err)
+	}
+
+	mux := http.NewServeMux()
+	// Metrics failing to collect are skipped, so the others are still served
+	mux.Handle("/metrics", promhttp.HandlerFor(c.metrics.registry, promhttp.HandlerOpts{
+		ErrorHandling: promhttp.ContinueOnError,
+	}))
+
+	c.metricsServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	c.waitGroupStop.Add(1)
+	go func() {
+		defer c.waitGroupStop.Done()
+
+		c.log.Infof("Serving metrics on %s", *metricsListen)
+
+		err := c.metricsServer.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			c.log.Errorf("Error serving metrics: %s", err)
+		}
+	}()
+
+	return nil
+}
+
+func (c *Controller) stopMetricsServer() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := c.metricsServer.Shutdown(ctx)
+	if err != nil {
+		c.log.Warnf("Error stopping metrics server: %s", err)
+	}
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestResultCollector(t *testing.T) {
+	c := &Controller{
+		checkers: map[string]IChecker{
+			CheckerTypeHttp: &HttpChecker{},
+		},
+		results: newResultCache(),
+	}
+
+	c.results.Update(
+		"web",
+		&apiagent.CheckV1Request{
+			CheckerType: CheckerTypeHttp,
+			Params: []*apiagent.CheckV1Param{
+				{Name: "url", Value: "http://localhost"},
+				{Name: thresholdParamPrefix + "resp_time", Value: "1s"},
+			},
+		},
+		&apiagent.CheckV1Result{
+			CheckUID: "uid1",
+			Status:   apiagent.CheckV1Status_CheckV1StatusOK,
+			Values: []*apiagent.CheckV1Value{
+				{Name: "resp_time", TypedValue: &apiagent.CheckV1Value_DurationValue{DurationValue: durationpb.New(1500 * time.Millisecond)}},
+				{Name: "status_code", TypedValue: &apiagent.CheckV1Value_IntValue{IntValue: 200}},
+			},
+		},
+	)
+
+	// Checks with different params share the labels of check_value
+	c.results.Update(
+		"cpu",
+		&apiagent.CheckV1Request{
+			CheckerType: CheckerTypeCpu,
+			Params: []*apiagent.CheckV1Param{
+				{Name: "cores", Value: "all"},
+			},
+		},
+		&apiagent.CheckV1Result{
+			CheckUID:  "uid2",
+			CheckType: "cpu",
+			Status:    apiagent.CheckV1Status_CheckV1StatusWarning,
+			Values: []*apiagent.CheckV1Value{
+				{Name: "usage", Unit: "%", TypedValue: &apiagent.CheckV1Value_DoubleValue{DoubleValue: 87.5}},
+			},
+		},
+	)
+
+	expected := `
+# HELP indece_monitor_agent_check_info Params of the check
+# TYPE indece_monitor_agent_check_info gauge
+indece_monitor_agent_check_info{check="web",check_type="",check_uid="uid1",checker_type="com.indece.agent.linux.v1.checker.http",param_cores="",param_url="http://localhost"} 1
+indece_monitor_agent_check_info{check="cpu",check_type="cpu",check_uid="uid2",checker_type="com.indece.agent.linux.v1.checker.cpu",param_cores="all",param_url=""} 1
+# HELP indece_monitor_agent_check_status Status of the latest check result (0=ok, 1=warning, 2=critical, 3=unknown)
+# TYPE indece_monitor_agent_check_status gauge
+indece_monitor_agent_check_status{check="web",check_type="",check_uid="uid1",checker_type="com.indece.agent.linux.v1.checker.http"} 0
+indece_monitor_agent_check_status{check="cpu",check_type="cpu",check_uid="uid2",checker_type="com.indece.agent.linux.v1.checker.cpu"} 1
+# HELP indece_monitor_agent_check_value Latest numeric values of the check
+# TYPE indece_monitor_agent_check_value gauge
+indece_monitor_agent_check_value{check="web",check_type="",check_uid="uid1",checker_type="com.indece.agent.linux.v1.checker.http",unit="",value="resp_time"} 1.5
+indece_monitor_agent_check_value{check="web",check_type="",check_uid="uid1",checker_type="com.indece.agent.linux.v1.checker.http",unit="",value="status_code"} 200
+indece_monitor_agent_check_value{check="cpu",check_type="cpu",check_uid="uid2",checker_type="com.indece.agent.linux.v1.checker.cpu",unit="%",value="usage"} 87.5
+`
+
+	err := testutil.CollectAndCompare(&resultCollector{controller: c}, strings.NewReader(expected))
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -15,16 +15,13 @@ func (c *Controller) pingLoop(ctx context.Context) error {
 	c.log.Infof("Starting ping sender")
 	defer c.log.Infof("Stopped ping sender")
 
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
 	tickerPing := time.NewTicker(10 * time.Second)
 	defer tickerPing.Stop()
 
-	for !c.stop {
+	for {
 		select {
-		case <-ticker.C:
-			continue
+		case <-ctx.Done():
+			return nil
 		case <-tickerPing.C:
 			req := &apiagent.PingV1Request{}
 
@@ -36,8 +33,8 @@ func (c *Controller) pingLoop(ctx context.Context) error {
 			if err != nil {
 				return fmt.Errorf("error sending ping: %s", err)
 			}
+
+			c.confirmReplay()
 		}
 	}
-
-	return nil
 }
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// addPluginCheckers adds a checker for each executable in the plugin dir,
+// plugins that can't be loaded are skipped
+func (c *Controller) addPluginCheckers() {
+	if *pluginDir == "" {
+		return
+	}
+
+	entries, err := os.ReadDir(*pluginDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.log.Warnf("Error reading plugin dir %s: %s", *pluginDir, err)
+		}
+
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		filename := filepath.Join(*pluginDir, entry.Name())
+
+		// Follows symlinks
+		fileInfo, err := os.Stat(filename)
+		if err != nil {
+			c.log.Warnf("Error loading plugin %s: %s", filename, err)
+
+			continue
+		}
+
+		if !fileInfo.Mode().IsRegular() || fileInfo.Mode().Perm()&0111 == 0 {
+			continue
+		}
+
+		// Plugins are run as the user of the agent, so they must not be
+		// modifiable by others
+		if fileInfo.Mode().Perm()&0022 != 0 {
+			c.log.Warnf("Skipping plugin %s: writable by group or others", filename)
+
+			continue
+		}
+
+		checker, err := NewPluginChecker(c.log, filename, *pluginTimeout)
+		if err != nil {
+			c.log.Warnf("Error loading plugin %s: %s", filename, err)
+
+			continue
+		}
+
+		// Plugins can't replace built-in checkers, even if they are disabled
+		if _, ok := c.checkers[checker.GetType()]; ok || c.builtinCheckers[checker.GetType()] {
+			c.log.Warnf("Skipping plugin %s: checker type %s already exists", filename, checker.GetType())
+
+			continue
+		}
+
+		c.log.Infof("Loaded plugin %s with checker type %s", filename, checker.GetType())
+
+		c.addChecker(checker)
+	}
+}
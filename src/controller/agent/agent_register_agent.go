@@ -3,21 +3,173 @@ package agent
 import (
 	"context"
 	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/indece-official/monitor-agent-linux/src/buildvars"
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/host"
+	"github.com/shirou/gopsutil/mem"
+	"google.golang.org/protobuf/proto"
 )
 
+// loadMachineID loads the systemd machine id, falling back to the host id
+// provided by gopsutil
+func loadMachineID(hostInfo *host.InfoStat) string {
+	for _, filename := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		data, err := os.ReadFile(filename)
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			return strings.TrimSpace(string(data))
+		}
+	}
+
+	return hostInfo.HostID
+}
+
+// loadIPAddresses returns the sorted ip addresses of all interfaces
+// except loopback
+func loadIPAddresses() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	ipAddresses := []string{}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			ipAddresses = append(ipAddresses, ipNet.IP.String())
+		}
+	}
+
+	sort.Strings(ipAddresses)
+
+	return ipAddresses, nil
+}
+
+// loadAgentInfo gathers the identity & inventory of the host
+func (c *Controller) loadAgentInfo(ctx context.Context) (*apiagent.RegisterAgentV1Request, error) {
+	hostInfo, err := host.InfoWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading host info: %s", err)
+	}
+
+	cpuInfos, err := cpu.InfoWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading cpu info: %s", err)
+	}
+
+	memInfo, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error loading memory info: %s", err)
+	}
+
+	ipAddresses, err := loadIPAddresses()
+	if err != nil {
+		return nil, fmt.Errorf("error loading ip addresses: %s", err)
+	}
+
+	cpuModel := ""
+	if len(cpuInfos) > 0 {
+		cpuModel = cpuInfos[0].ModelName
+	}
+
+	return &apiagent.RegisterAgentV1Request{
+		Type:                "com.indece.agent.linux.v1",
+		Version:             buildvars.BuildVersion,
+		Hostname:            hostInfo.Hostname,
+		MachineID:           loadMachineID(hostInfo),
+		Kernel:              hostInfo.KernelVersion,
+		Distribution:        hostInfo.Platform,
+		DistributionVersion: hostInfo.PlatformVersion,
+		Architecture:        hostInfo.KernelArch,
+		CpuModel:            cpuModel,
+		MemoryTotal:         memInfo.Total,
+		IpAddresses:         ipAddresses,
+		BuildDate:           buildvars.BuildDate,
+	}, nil
+}
+
 func (c *Controller) registerAgent(ctx context.Context) error {
-	req := &apiagent.RegisterAgentV1Request{
-		Type:    "com.indece.agent.linux.v1",
-		Version: buildvars.BuildVersion,
+	req, err := c.loadAgentInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.grpcClient.RegisterAgentV1(ctx, req)
+	if err != nil {
+		return fmt.Errorf("error registering agent: %s", err)
+	}
+
+	c.mutexAgentInfo.Lock()
+	c.agentInfo = req
+	c.mutexAgentInfo.Unlock()
+
+	return nil
+}
+
+// updateAgentInfo registers the agent again if its inventory changed since
+// the last registration
+func (c *Controller) updateAgentInfo(ctx context.Context) error {
+	req, err := c.loadAgentInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mutexAgentInfo.Lock()
+	changed := c.agentInfo != nil && !proto.Equal(c.agentInfo, req)
+	c.mutexAgentInfo.Unlock()
+
+	// The initial registration is done by the registration loop after connecting
+	if !changed {
+		return nil
 	}
 
-	_, err := c.grpcClient.RegisterAgentV1(ctx, req)
+	c.log.Infof("Agent inventory changed, registering agent again")
+
+	_, err = c.grpcClient.RegisterAgentV1(ctx, req)
 	if err != nil {
 		return fmt.Errorf("error registering agent: %s", err)
 	}
 
+	c.mutexAgentInfo.Lock()
+	c.agentInfo = req
+	c.mutexAgentInfo.Unlock()
+
 	return nil
 }
+
+func (c *Controller) agentInfoLoop(ctx context.Context) {
+	ticker := time.NewTicker(*agentInfoInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := c.updateAgentInfo(ctx)
+			if err != nil {
+				c.log.Warnf("Error updating agent inventory: %s", err)
+			}
+		}
+	}
+}
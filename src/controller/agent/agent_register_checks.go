@@ -7,23 +7,42 @@ import (
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
 )
 
+func (c *Controller) registerCheck(ctx context.Context, reqCheck *apiagent.CheckV1) error {
+	req := &apiagent.RegisterCheckV1Request{}
+	req.Check = reqCheck
+
+	_, err := c.grpcClient.RegisterCheckV1(ctx, req)
+	if err != nil {
+		return fmt.Errorf("error registering check %s for checker %s: %s", reqCheck.Type, reqCheck.CheckerType, err)
+	}
+
+	return nil
+}
+
 func (c *Controller) registerChecks(ctx context.Context) error {
 	for _, checker := range c.checkers {
 		reqChecks, err := checker.GetChecks()
 		if err != nil {
-			return fmt.Errorf("error loading checks registration for checker %s: %s", checker.GetType(), err)
-		}
+			// Register the checks of the other checkers anyway
+			c.log.Warnf("Error loading checks registration for checker %s: %s", checker.GetType(), err)
 
-		for _, reqCheck := range reqChecks {
-			req := &apiagent.RegisterCheckV1Request{}
-			req.Check = reqCheck
+			continue
+		}
 
-			_, err = c.grpcClient.RegisterCheckV1(ctx, req)
+		for _, reqCheck := range c.checkFilter.Apply(reqChecks) {
+			err = c.registerCheck(ctx, reqCheck)
 			if err != nil {
-				return fmt.Errorf("error registering check %s for checker %s: %s", reqCheck.CheckerType, checker.GetType(), err)
+				return err
 			}
 		}
 	}
 
+	for _, reqCheck := range c.getLocalChecks() {
+		err := c.registerCheck(ctx, reqCheck)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"google.golang.org/protobuf/proto"
+)
+
+// resultEntry is the latest result of a check
+type resultEntry struct {
+	Key         string
+	Name        string
+	CheckUID    string
+	CheckType   string
+	CheckerType string
+	Params      []*apiagent.CheckV1Param
+	Result      *apiagent.CheckV1Result
+}
+
+// resultCache keeps the latest result of every check, e.g. for exporting
+// them as metrics
+type resultCache struct {
+	mutex   sync.Mutex
+	entries map[string]*resultEntry
+}
+
+// Update stores a check result, results of checks without check uid or type
+// (e.g. one-time requests by the server) are ignored
+func (r *resultCache) Update(name string, checkRequest *apiagent.CheckV1Request, checkResult *apiagent.CheckV1Result) {
+	key := checkResult.CheckUID
+	if key == "" {
+		key = checkResult.CheckType
+	}
+	if key == "" {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.entries[key] = &resultEntry{
+		Key:         key,
+		Name:        name,
+		CheckUID:    checkResult.CheckUID,
+		CheckType:   checkResult.CheckType,
+		CheckerType: checkRequest.CheckerType,
+		Params:      checkRequest.Params,
+		Result:      proto.Clone(checkResult).(*apiagent.CheckV1Result),
+	}
+}
+
+// List returns the latest results of all checks sorted by their key
+//
+// The returned entries must not be modified
+func (r *resultCache) List() []*resultEntry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	entries := []*resultEntry{}
+	for _, entry := range r.entries {
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Key < entries[j].Key
+	})
+
+	return entries
+}
+
+func newResultCache() *resultCache {
+	return &resultCache{
+		entries: map[string]*resultEntry{},
+	}
+}
@@ -0,0 +1,527 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/indece-official/go-gousu/v2/gousu/logger"
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	ScheduleModeServer = "server"
+	ScheduleModeAgent  = "agent"
+)
+
+// Used for checks without schedule whose checker has no default schedule
+const defaultCheckSchedule = "0 * * * * *"
+
+type scheduledCheck struct {
+	// Action of the server request the check was scheduled for
+	ActionUID   string            `json:"actionUID,omitempty"`
+	CheckUID    string            `json:"checkUID,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	CheckType   string            `json:"checkType,omitempty"`
+	CheckerType string            `json:"checkerType"`
+	Schedule    string            `json:"schedule,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+	Params      map[string]string `json:"params"`
+	// Time the server requested the check the last time
+	requestedAt time.Time
+}
+
+func (s *scheduledCheck) key() string {
+	if s.CheckUID != "" {
+		return s.CheckUID
+	}
+
+	return s.CheckType
+}
+
+// equals ignores the action uid, so a check requested again by the server
+// keeps the action uid of the request it was scheduled for
+func (s *scheduledCheck) equals(o *scheduledCheck) bool {
+	if s.CheckUID != o.CheckUID ||
+		s.CheckType != o.CheckType ||
+		s.Name != o.Name ||
+		s.CheckerType != o.CheckerType ||
+		s.Schedule != o.Schedule ||
+		s.Timeout != o.Timeout ||
+		len(s.Params) != len(o.Params) {
+		return false
+	}
+
+	for name, value := range s.Params {
+		if oValue, ok := o.Params[name]; !ok || oValue != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *scheduledCheck) request() *apiagent.CheckV1Request {
+	req := &apiagent.CheckV1Request{
+		ActionUID:   s.ActionUID,
+		CheckUID:    s.CheckUID,
+		CheckerType: s.CheckerType,
+		Timeout:     s.Timeout,
+		Params:      []*apiagent.CheckV1Param{},
+	}
+
+	for name, value := range s.Params {
+		req.Params = append(req.Params, &apiagent.CheckV1Param{
+			Name:  name,
+			Value: value,
+		})
+	}
+
+	return req
+}
+
+func newScheduledCheck(checkUID string, name string, checkType string, checkerType string, schedule string, timeout string, params []*apiagent.CheckV1Param) *scheduledCheck {
+	check := &scheduledCheck{
+		CheckUID:    checkUID,
+		Name:        name,
+		CheckType:   checkType,
+		CheckerType: checkerType,
+		Schedule:    schedule,
+		Timeout:     timeout,
+		Params:      map[string]string{},
+	}
+
+	for _, param := range params {
+		check.Params[param.Name] = param.Value
+	}
+
+	return check
+}
+
+func newCronParser() cron.Parser {
+	return cron.NewParser(
+		cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+	)
+}
+
+type checkSchedulerEntry struct {
+	check   *scheduledCheck
+	entryID cron.EntryID
+}
+
+// checkScheduler runs checks locally based on their cron schedule
+//
+// The check set received from the server is persisted, so it is available
+// after restarts while the server is not reachable. Server checks which
+// were not requested by the server for serverCheckExpiry are removed, the
+// autodiscovered checks are scheduled again when no server check is left.
+type checkScheduler struct {
+	log               *logger.Log
+	filename          string
+	serverCheckExpiry time.Duration
+	cron              *cron.Cron
+	parser            cron.Parser
+	run               func(check *scheduledCheck)
+	mutex             sync.Mutex
+	entries           map[string]*checkSchedulerEntry
+	localChecks       []*scheduledCheck
+	serverChecks      map[string]*scheduledCheck
+}
+
+func (s *checkScheduler) loadServerChecks() error {
+	data, err := os.ReadFile(s.filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading check set: %s", err)
+	}
+
+	checks := []*scheduledCheck{}
+
+	err = json.Unmarshal(data, &checks)
+	if err != nil {
+		return fmt.Errorf("error decoding check set: %s", err)
+	}
+
+	// The server gets the full expiry time after a restart to request the
+	// checks again
+	now := time.Now()
+
+	for _, check := range checks {
+		check.requestedAt = now
+
+		s.serverChecks[check.key()] = check
+	}
+
+	return nil
+}
+
+func (s *checkScheduler) storeServerChecks() error {
+	checks := []*scheduledCheck{}
+
+	for _, check := range s.serverChecks {
+		checks = append(checks, check)
+	}
+
+	data, err := json.Marshal(checks)
+	if err != nil {
+		return fmt.Errorf("error encoding check set: %s", err)
+	}
+
+	err = os.WriteFile(s.filename+".tmp", data, 0600)
+	if err != nil {
+		return fmt.Errorf("error writing check set: %s", err)
+	}
+
+	err = os.Rename(s.filename+".tmp", s.filename)
+	if err != nil {
+		return fmt.Errorf("error writing check set: %s", err)
+	}
+
+	return nil
+}
+
+func (s *checkScheduler) schedule(check *scheduledCheck) error {
+	if entry, ok := s.entries[check.key()]; ok {
+		if entry.check.equals(check) {
+			return nil
+		}
+
+		s.cron.Remove(entry.entryID)
+		delete(s.entries, check.key())
+	}
+
+	schedule, err := s.parser.Parse(check.Schedule)
+	if err != nil {
+		return fmt.Errorf("error parsing schedule '%s' of check %s: %s", check.Schedule, check.key(), err)
+	}
+
+	entryID := s.cron.Schedule(
+		schedule,
+		cron.NewChain(cron.SkipIfStillRunning(cron.DiscardLogger)).Then(cron.FuncJob(func() {
+			s.run(check)
+		})),
+	)
+
+	s.entries[check.key()] = &checkSchedulerEntry{
+		check:   check,
+		entryID: entryID,
+	}
+
+	return nil
+}
+
+func (s *checkScheduler) apply(checks []*scheduledCheck) error {
+	keys := map[string]bool{}
+
+	for _, check := range checks {
+		keys[check.key()] = true
+
+		err := s.schedule(check)
+		if err != nil {
+			return err
+		}
+	}
+
+	for key, entry := range s.entries {
+		if !keys[key] {
+			s.cron.Remove(entry.entryID)
+			delete(s.entries, key)
+		}
+	}
+
+	return nil
+}
+
+// SetLocalChecks schedules the autodiscovered checks as long as no check
+// set was received from the server
+func (s *checkScheduler) SetLocalChecks(checks []*scheduledCheck) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.localChecks = checks
+
+	if len(s.serverChecks) > 0 {
+		return nil
+	}
+
+	return s.apply(checks)
+}
+
+// AddServerCheck adds or updates a check received from the server,
+// replacing the autodiscovered checks
+func (s *checkScheduler) AddServerCheck(check *scheduledCheck) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	check.requestedAt = time.Now()
+
+	if existingCheck, ok := s.serverChecks[check.key()]; ok && existingCheck.equals(check) {
+		existingCheck.requestedAt = check.requestedAt
+
+		return nil
+	}
+
+	if len(s.serverChecks) == 0 {
+		// Drop autodiscovered checks
+		err := s.apply([]*scheduledCheck{})
+		if err != nil {
+			return err
+		}
+	}
+
+	s.serverChecks[check.key()] = check
+
+	err := s.storeServerChecks()
+	if err != nil {
+		return err
+	}
+
+	return s.schedule(check)
+}
+
+// expireServerChecks removes the server checks not requested by the server
+// for serverCheckExpiry
+func (s *checkScheduler) expireServerChecks() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	expired := false
+
+	for key, check := range s.serverChecks {
+		if time.Since(check.requestedAt) <= s.serverCheckExpiry {
+			continue
+		}
+
+		s.log.Infof("Removing check %s not requested by the server for %s", key, s.serverCheckExpiry)
+
+		delete(s.serverChecks, key)
+
+		if entry, ok := s.entries[key]; ok {
+			s.cron.Remove(entry.entryID)
+			delete(s.entries, key)
+		}
+
+		expired = true
+	}
+
+	if !expired {
+		return nil
+	}
+
+	err := s.storeServerChecks()
+	if err != nil {
+		return err
+	}
+
+	if len(s.serverChecks) == 0 {
+		return s.apply(s.localChecks)
+	}
+
+	return nil
+}
+
+func (s *checkScheduler) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.serverCheckExpiry > 0 {
+		s.cron.Schedule(cron.Every(time.Minute), cron.FuncJob(func() {
+			err := s.expireServerChecks()
+			if err != nil {
+				s.log.Warnf("Error removing expired checks: %s", err)
+			}
+		}))
+	}
+
+	if len(s.serverChecks) > 0 {
+		checks := []*scheduledCheck{}
+		for _, check := range s.serverChecks {
+			checks = append(checks, check)
+		}
+
+		err := s.apply(checks)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.cron.Start()
+
+	return nil
+}
+
+// Checks returns the currently scheduled checks sorted by their key
+func (s *checkScheduler) Checks() []*scheduledCheck {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	checks := []*scheduledCheck{}
+	for _, entry := range s.entries {
+		checks = append(checks, entry.check)
+	}
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].key() < checks[j].key()
+	})
+
+	return checks
+}
+
+// Stop stops the scheduler without waiting for running checks
+func (s *checkScheduler) Stop() {
+	s.cron.Stop()
+}
+
+func newCheckScheduler(log *logger.Log, filename string, serverCheckExpiry time.Duration, run func(check *scheduledCheck)) (*checkScheduler, error) {
+	s := &checkScheduler{
+		log:               log,
+		filename:          filename,
+		serverCheckExpiry: serverCheckExpiry,
+		cron:              cron.New(),
+		parser:            newCronParser(),
+		run:               run,
+		entries:           map[string]*checkSchedulerEntry{},
+		serverChecks:      map[string]*scheduledCheck{},
+	}
+
+	err := s.loadServerChecks()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// scheduledCheckFromRequest builds a scheduled check from a check request
+// received from the server, using the checkers default schedule & timeout
+func (c *Controller) scheduledCheckFromRequest(checkRequest *apiagent.CheckV1Request) (*scheduledCheck, error) {
+	checker, ok := c.checkers[checkRequest.CheckerType]
+	if !ok {
+		return nil, fmt.Errorf("unknown checker type %s", checkRequest.CheckerType)
+	}
+
+	reqChecker, err := checker.GetChecker()
+	if err != nil {
+		return nil, fmt.Errorf("error loading checker %s: %s", checker.GetType(), err)
+	}
+
+	schedule := reqChecker.DefaultSchedule
+	if schedule == "" {
+		schedule = defaultCheckSchedule
+	}
+
+	timeout := checkRequest.Timeout
+	if timeout == "" {
+		timeout = reqChecker.DefaultTimeout
+	}
+
+	check := newScheduledCheck(
+		checkRequest.CheckUID,
+		"",
+		"",
+		checkRequest.CheckerType,
+		schedule,
+		timeout,
+		checkRequest.Params,
+	)
+	check.ActionUID = checkRequest.ActionUID
+
+	return check, nil
+}
+
+func scheduledCheckFromCheck(reqChecker *apiagent.CheckerV1, reqCheck *apiagent.CheckV1) *scheduledCheck {
+	schedule := reqCheck.Schedule
+	if schedule == "" {
+		schedule = reqChecker.DefaultSchedule
+	}
+	if schedule == "" {
+		schedule = defaultCheckSchedule
+	}
+
+	timeout := reqCheck.Timeout
+	if timeout == "" {
+		timeout = reqChecker.DefaultTimeout
+	}
+
+	return newScheduledCheck(
+		"",
+		reqCheck.Name,
+		reqCheck.Type,
+		reqCheck.CheckerType,
+		schedule,
+		timeout,
+		reqCheck.Params,
+	)
+}
+
+// localScheduledChecks returns the autodiscovered checks of all checkers
+// and the checks defined in local config files
+//
+// Checkers failing to load their checks are skipped, so they don't prevent
+// the checks of other checkers from running
+func (c *Controller) localScheduledChecks() []*scheduledCheck {
+	checks := []*scheduledCheck{}
+
+	for _, checker := range c.checkers {
+		reqChecker, err := checker.GetChecker()
+		if err != nil {
+			c.log.Warnf("Error loading checker %s: %s", checker.GetType(), err)
+
+			continue
+		}
+
+		reqChecks, err := checker.GetChecks()
+		if err != nil {
+			c.log.Warnf("Error loading checks for checker %s: %s", checker.GetType(), err)
+
+			continue
+		}
+
+		for _, reqCheck := range c.checkFilter.Apply(reqChecks) {
+			checks = append(checks, scheduledCheckFromCheck(reqChecker, reqCheck))
+		}
+	}
+
+	for _, reqCheck := range c.getLocalChecks() {
+		checker, ok := c.checkers[reqCheck.CheckerType]
+		if !ok {
+			c.log.Warnf("Unknown checker type %s of local check %s", reqCheck.CheckerType, reqCheck.Type)
+
+			continue
+		}
+
+		reqChecker, err := checker.GetChecker()
+		if err != nil {
+			c.log.Warnf("Error loading checker %s: %s", reqCheck.CheckerType, err)
+
+			continue
+		}
+
+		checks = append(checks, scheduledCheckFromCheck(reqChecker, reqCheck))
+	}
+
+	return checks
+}
+
+func (c *Controller) runScheduledCheck(check *scheduledCheck) {
+	if !c.trackCheck() {
+		return
+	}
+	defer c.waitGroupChecks.Done()
+
+	checkRequest := check.request()
+
+	checkResult := c.runCheck(c.ctxChecks, check.key(), checkRequest)
+	checkResult.CheckType = check.CheckType
+
+	err := c.reportResult(check.Name, checkRequest, checkResult)
+	if err != nil {
+		c.log.Errorf("Error sending result of scheduled check %s: %s", check.key(), err)
+	}
+}
@@ -0,0 +1,29 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+)
+
+func TestScheduledCheckActionUID(t *testing.T) {
+	params := []*apiagent.CheckV1Param{
+		{Name: "path", Value: "/"},
+	}
+
+	check := newScheduledCheck("uid1", "", "", CheckerTypeDisk, "0 * * * * *", "", params)
+	check.ActionUID = "action1"
+
+	requestedAgain := newScheduledCheck("uid1", "", "", CheckerTypeDisk, "0 * * * * *", "", params)
+	requestedAgain.ActionUID = "action2"
+
+	// Requesting the check again doesn't reschedule it
+	if !check.equals(requestedAgain) {
+		t.Errorf("got checks with different action uids not equal")
+	}
+
+	req := check.request()
+	if req.ActionUID != "action1" || req.CheckUID != "uid1" {
+		t.Errorf("got action uid %s and check uid %s, want action1 and uid1", req.ActionUID, req.CheckUID)
+	}
+}
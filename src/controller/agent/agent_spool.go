@@ -0,0 +1,277 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"google.golang.org/protobuf/proto"
+)
+
+const spoolFileExtension = ".pb"
+
+type spoolEntry struct {
+	filename  string
+	size      int64
+	createdAt time.Time
+}
+
+// resultSpool persists check results that could not be sent to the server
+// in a directory (one file per result) and replays them in order
+//
+// Replayed results are kept until they are confirmed, as a successful send
+// doesn't guarantee that the server received them
+type resultSpool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	mutex   sync.Mutex
+	entries []*spoolEntry
+	size    int64
+	lastSeq int64
+	// Number of entries at the start of the spool sent by the last replay
+	sent int
+}
+
+func (s *resultSpool) load() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("error reading spool dir %s: %s", s.dir, err)
+	}
+
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), spoolFileExtension+".tmp") {
+			// Remove partially written files of a previous run
+			err = os.Remove(filepath.Join(s.dir, file.Name()))
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("error removing spool file %s: %s", file.Name(), err)
+			}
+
+			continue
+		}
+
+		if file.IsDir() || !strings.HasSuffix(file.Name(), spoolFileExtension) {
+			continue
+		}
+
+		seq, err := strconv.ParseInt(strings.TrimSuffix(file.Name(), spoolFileExtension), 10, 64)
+		if err != nil {
+			// Ignore foreign files
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			return fmt.Errorf("error loading spool file %s: %s", file.Name(), err)
+		}
+
+		s.entries = append(s.entries, &spoolEntry{
+			filename:  file.Name(),
+			size:      info.Size(),
+			createdAt: time.Unix(0, seq),
+		})
+		s.size += info.Size()
+
+		if seq > s.lastSeq {
+			s.lastSeq = seq
+		}
+	}
+
+	sort.Slice(s.entries, func(i, j int) bool {
+		return s.entries[i].filename < s.entries[j].filename
+	})
+
+	return nil
+}
+
+func (s *resultSpool) removeEntry(entry *spoolEntry) error {
+	err := os.Remove(filepath.Join(s.dir, entry.filename))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing spool file %s: %s", entry.filename, err)
+	}
+
+	s.size -= entry.size
+
+	return nil
+}
+
+// enforceLimits drops the oldest entries exceeding the max age or max size
+func (s *resultSpool) enforceLimits() error {
+	now := time.Now()
+
+	for len(s.entries) > 0 {
+		entry := s.entries[0]
+
+		if s.size <= s.maxSize && now.Sub(entry.createdAt) <= s.maxAge {
+			break
+		}
+
+		err := s.removeEntry(entry)
+		if err != nil {
+			return err
+		}
+
+		s.entries = s.entries[1:]
+		if s.sent > 0 {
+			s.sent--
+		}
+	}
+
+	return nil
+}
+
+// Add persists a result at the end of the spool
+func (s *resultSpool) Add(result *apiagent.CheckV1Result) error {
+	data, err := proto.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error encoding result: %s", err)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	seq := time.Now().UnixNano()
+	if seq <= s.lastSeq {
+		seq = s.lastSeq + 1
+	}
+	s.lastSeq = seq
+
+	entry := &spoolEntry{
+		filename:  fmt.Sprintf("%020d%s", seq, spoolFileExtension),
+		size:      int64(len(data)),
+		createdAt: time.Unix(0, seq),
+	}
+
+	filenameTmp := filepath.Join(s.dir, entry.filename+".tmp")
+
+	err = os.WriteFile(filenameTmp, data, 0600)
+	if err != nil {
+		return fmt.Errorf("error writing spool file: %s", err)
+	}
+
+	err = os.Rename(filenameTmp, filepath.Join(s.dir, entry.filename))
+	if err != nil {
+		os.Remove(filenameTmp)
+
+		return fmt.Errorf("error writing spool file: %s", err)
+	}
+
+	s.entries = append(s.entries, entry)
+	s.size += entry.size
+
+	return s.enforceLimits()
+}
+
+// Replay calls send for every spooled result in order, the results are
+// removed from the spool by Confirm
+//
+// Stops at the first failing call, keeping all results
+func (s *resultSpool) Replay(send func(result *apiagent.CheckV1Result) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sent = 0
+
+	err := s.enforceLimits()
+	if err != nil {
+		return err
+	}
+
+	for s.sent < len(s.entries) {
+		entry := s.entries[s.sent]
+
+		data, err := os.ReadFile(filepath.Join(s.dir, entry.filename))
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error reading spool file %s: %s", entry.filename, err)
+		}
+
+		if err == nil {
+			result := &apiagent.CheckV1Result{}
+
+			err = proto.Unmarshal(data, result)
+			if err == nil {
+				err = send(result)
+				if err != nil {
+					s.sent = 0
+
+					return err
+				}
+
+				s.sent++
+
+				continue
+			}
+			// Undecodable files are dropped
+		}
+
+		err = s.removeEntry(entry)
+		if err != nil {
+			return err
+		}
+
+		s.entries = append(s.entries[:s.sent], s.entries[s.sent+1:]...)
+	}
+
+	return nil
+}
+
+// Confirm removes the results sent by the last replay from the spool
+func (s *resultSpool) Confirm() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for s.sent > 0 {
+		err := s.removeEntry(s.entries[0])
+		if err != nil {
+			return err
+		}
+
+		s.entries = s.entries[1:]
+		s.sent--
+	}
+
+	return nil
+}
+
+// Len returns the number of spooled results
+func (s *resultSpool) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.entries)
+}
+
+// Size returns the total size of all spooled results in bytes
+func (s *resultSpool) Size() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.size
+}
+
+func newResultSpool(dir string, maxSize int64, maxAge time.Duration) (*resultSpool, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("error creating spool dir %s: %s", dir, err)
+	}
+
+	s := &resultSpool{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		entries: []*spoolEntry{},
+	}
+
+	err = s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+)
+
+func TestResultSpool(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxSize    int64
+		add        []string
+		reload     bool
+		failAt     int
+		confirm    bool
+		wantSent   []string
+		wantRemain int
+	}{
+		{
+			name:     "replay in order",
+			maxSize:  1024 * 1024,
+			add:      []string{"a", "b", "c"},
+			failAt:   -1,
+			confirm:  true,
+			wantSent: []string{"a", "b", "c"},
+		},
+		{
+			name:     "replay after reload",
+			maxSize:  1024 * 1024,
+			add:      []string{"a", "b", "c"},
+			reload:   true,
+			failAt:   -1,
+			confirm:  true,
+			wantSent: []string{"a", "b", "c"},
+		},
+		{
+			name:       "keep results until confirmed",
+			maxSize:    1024 * 1024,
+			add:        []string{"a", "b", "c"},
+			failAt:     -1,
+			wantSent:   []string{"a", "b", "c"},
+			wantRemain: 3,
+		},
+		{
+			name:       "keep results after failed send",
+			maxSize:    1024 * 1024,
+			add:        []string{"a", "b", "c"},
+			failAt:     1,
+			confirm:    true,
+			wantSent:   []string{"a"},
+			wantRemain: 3,
+		},
+		{
+			name:     "drop oldest results above max size",
+			maxSize:  8,
+			add:      []string{"a", "b", "c"},
+			failAt:   -1,
+			confirm:  true,
+			wantSent: []string{"b", "c"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			spool, err := newResultSpool(dir, test.maxSize, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, checkUID := range test.add {
+				err = spool.Add(&apiagent.CheckV1Result{CheckUID: checkUID})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if test.reload {
+				spool, err = newResultSpool(dir, test.maxSize, time.Hour)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sent := []string{}
+
+			err = spool.Replay(func(result *apiagent.CheckV1Result) error {
+				if len(sent) == test.failAt {
+					return fmt.Errorf("send failed")
+				}
+
+				sent = append(sent, result.CheckUID)
+
+				return nil
+			})
+			if (err != nil) != (test.failAt >= 0) {
+				t.Fatalf("got error %v", err)
+			}
+
+			if !reflect.DeepEqual(sent, test.wantSent) {
+				t.Errorf("got sent %v, want %v", sent, test.wantSent)
+			}
+
+			if test.confirm {
+				err = spool.Confirm()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if spool.Len() != test.wantRemain {
+				t.Errorf("got %d remaining results, want %d", spool.Len(), test.wantRemain)
+			}
+		})
+	}
+}
+
+func TestResultSpoolRemovesTmpFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	filenameTmp := filepath.Join(dir, "00000000000000000001.pb.tmp")
+
+	err := os.WriteFile(filenameTmp, []byte("partial"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spool, err := newResultSpool(dir, 1024, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if spool.Len() != 0 {
+		t.Errorf("got %d results, want 0", spool.Len())
+	}
+
+	if _, err := os.Stat(filenameTmp); !os.IsNotExist(err) {
+		t.Errorf("got tmp file not removed: %v", err)
+	}
+}
@@ -0,0 +1,331 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/buildvars"
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const hiddenParamValue = "********"
+
+type statusAPIStatus struct {
+	Version         string `json:"version"`
+	BuildDate       string `json:"buildDate"`
+	ScheduleMode    string `json:"scheduleMode"`
+	Server          string `json:"server"`
+	ConnectionState string `json:"connectionState"`
+	Connections     uint64 `json:"connections"`
+	Error           string `json:"error,omitempty"`
+	ChecksQueued    int    `json:"checksQueued"`
+	ChecksRunning   int    `json:"checksRunning"`
+	SpoolResults    int    `json:"spoolResults"`
+	SpoolSize       int64  `json:"spoolSize"`
+}
+
+type statusAPICheck struct {
+	CheckUID    string            `json:"checkUID,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	CheckType   string            `json:"checkType,omitempty"`
+	CheckerType string            `json:"checkerType"`
+	Schedule    string            `json:"schedule,omitempty"`
+	Timeout     string            `json:"timeout,omitempty"`
+	Params      map[string]string `json:"params"`
+}
+
+type statusAPIResult struct {
+	Key         string            `json:"key"`
+	Name        string            `json:"name,omitempty"`
+	CheckUID    string            `json:"checkUID,omitempty"`
+	CheckType   string            `json:"checkType,omitempty"`
+	CheckerType string            `json:"checkerType"`
+	Params      map[string]string `json:"params"`
+	Result      json.RawMessage   `json:"result"`
+}
+
+// hiddenParams returns the names of the password params of a checker
+func (c *Controller) hiddenParams(checkerType string) map[string]bool {
+	hiddenParams := map[string]bool{}
+
+	checker, ok := c.checkers[checkerType]
+	if !ok {
+		return hiddenParams
+	}
+
+	reqChecker, err := checker.GetChecker()
+	if err != nil {
+		return hiddenParams
+	}
+
+	for _, checkerParam := range reqChecker.Params {
+		if checkerParam.Type == apiagent.CheckerV1ParamType_CheckerV1ParamTypePassword {
+			hiddenParams[checkerParam.Name] = true
+		}
+	}
+
+	return hiddenParams
+}
+
+// maskParams copies params, hiding the values of passwords
+func (c *Controller) maskParams(checkerType string, params map[string]string) map[string]string {
+	hiddenParams := c.hiddenParams(checkerType)
+
+	apiParams := map[string]string{}
+	for name, value := range params {
+		if hiddenParams[name] {
+			value = hiddenParamValue
+		}
+
+		apiParams[name] = value
+	}
+
+	return apiParams
+}
+
+func (c *Controller) writeStatusAPIResponse(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		c.log.Warnf("Error writing status api response: %s", err)
+	}
+}
+
+func (c *Controller) writeStatusAPIError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": err.Error(),
+	})
+}
+
+func (c *Controller) handleStatusAPIStatus(w http.ResponseWriter, r *http.Request) {
+	c.mutexConnState.Lock()
+	connState := c.connState
+	connGeneration := c.connGeneration
+	c.mutexConnState.Unlock()
+
+	queued, running := c.checkPool.Stats()
+
+	status := &statusAPIStatus{
+		Version:         buildvars.BuildVersion,
+		BuildDate:       buildvars.BuildDate,
+		ScheduleMode:    *scheduleMode,
+		Server:          fmt.Sprintf("%s:%d", *serverHost, *serverPort),
+		ConnectionState: connState.String(),
+		Connections:     connGeneration,
+		ChecksQueued:    queued,
+		ChecksRunning:   running,
+		SpoolResults:    c.spool.Len(),
+		SpoolSize:       c.spool.Size(),
+	}
+
+	err := c.Health()
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	c.writeStatusAPIResponse(w, status)
+}
+
+func (c *Controller) handleStatusAPICheckers(w http.ResponseWriter, r *http.Request) {
+	checkers := []json.RawMessage{}
+
+	for _, checkerType := range sortedCheckerTypes(c.checkers) {
+		reqChecker, err := c.checkers[checkerType].GetChecker()
+		if err != nil {
+			c.writeStatusAPIError(w, http.StatusInternalServerError, fmt.Errorf("error loading checker %s: %s", checkerType, err))
+
+			return
+		}
+
+		data, err := protojson.Marshal(reqChecker)
+		if err != nil {
+			c.writeStatusAPIError(w, http.StatusInternalServerError, fmt.Errorf("error encoding checker %s: %s", checkerType, err))
+
+			return
+		}
+
+		checkers = append(checkers, data)
+	}
+
+	c.writeStatusAPIResponse(w, checkers)
+}
+
+// handleStatusAPIChecks lists the active checks: the scheduled checks in
+// agent schedule mode, otherwise the checks run on request of the server
+func (c *Controller) handleStatusAPIChecks(w http.ResponseWriter, r *http.Request) {
+	checks := []*scheduledCheck{}
+
+	if c.scheduler != nil {
+		checks = c.scheduler.Checks()
+	} else {
+		// The results are already sorted by check uid
+		for _, entry := range c.results.List() {
+			if entry.CheckUID == "" {
+				continue
+			}
+
+			checks = append(checks, newScheduledCheck(
+				entry.CheckUID,
+				entry.Name,
+				entry.CheckType,
+				entry.CheckerType,
+				"",
+				"",
+				entry.Params,
+			))
+		}
+	}
+
+	apiChecks := []*statusAPICheck{}
+
+	for _, check := range checks {
+		apiChecks = append(apiChecks, &statusAPICheck{
+			CheckUID:    check.CheckUID,
+			Name:        check.Name,
+			CheckType:   check.CheckType,
+			CheckerType: check.CheckerType,
+			Schedule:    check.Schedule,
+			Timeout:     check.Timeout,
+			Params:      c.maskParams(check.CheckerType, check.Params),
+		})
+	}
+
+	c.writeStatusAPIResponse(w, apiChecks)
+}
+
+func (c *Controller) handleStatusAPIResults(w http.ResponseWriter, r *http.Request) {
+	apiResults := []*statusAPIResult{}
+
+	for _, entry := range c.results.List() {
+		params := map[string]string{}
+		for _, param := range entry.Params {
+			params[param.Name] = param.Value
+		}
+
+		data, err := protojson.Marshal(entry.Result)
+		if err != nil {
+			c.writeStatusAPIError(w, http.StatusInternalServerError, fmt.Errorf("error encoding result of check %s: %s", entry.Key, err))
+
+			return
+		}
+
+		apiResults = append(apiResults, &statusAPIResult{
+			Key:         entry.Key,
+			Name:        entry.Name,
+			CheckUID:    entry.CheckUID,
+			CheckType:   entry.CheckType,
+			CheckerType: entry.CheckerType,
+			Params:      c.maskParams(entry.CheckerType, params),
+			Result:      data,
+		})
+	}
+
+	c.writeStatusAPIResponse(w, apiResults)
+}
+
+func (c *Controller) listenStatusAPI() ([]net.Listener, error) {
+	listeners := []net.Listener{}
+
+	if *statusSocket != "" {
+		err := os.MkdirAll(filepath.Dir(*statusSocket), 0755)
+		if err != nil {
+			return nil, fmt.Errorf("error creating directory for %s: %s", *statusSocket, err)
+		}
+
+		// Remove a stale socket of a previous run
+		err = os.Remove(*statusSocket)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error removing %s: %s", *statusSocket, err)
+		}
+
+		listener, err := net.Listen("unix", *statusSocket)
+		if err != nil {
+			return nil, fmt.Errorf("error listening on %s: %s", *statusSocket, err)
+		}
+
+		err = os.Chmod(*statusSocket, 0660)
+		if err != nil {
+			listener.Close()
+
+			return nil, fmt.Errorf("error setting permissions of %s: %s", *statusSocket, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	if *statusListen != "" {
+		listener, err := net.Listen("tcp", *statusListen)
+		if err != nil {
+			for _, otherListener := range listeners {
+				otherListener.Close()
+			}
+
+			return nil, fmt.Errorf("error listening on %s: %s", *statusListen, err)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
+
+// startStatusAPI starts the local status api on the unix socket and the
+// optional tcp listener
+func (c *Controller) startStatusAPI() error {
+	listeners, err := c.listenStatusAPI()
+	if err != nil {
+		return err
+	}
+
+	if len(listeners) == 0 {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/status", c.handleStatusAPIStatus)
+	mux.HandleFunc("/v1/checkers", c.handleStatusAPICheckers)
+	mux.HandleFunc("/v1/checks", c.handleStatusAPIChecks)
+	mux.HandleFunc("/v1/results", c.handleStatusAPIResults)
+
+	c.statusServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	for _, listener := range listeners {
+		c.log.Infof("Serving status api on %s", listener.Addr())
+
+		c.waitGroupStop.Add(1)
+		go func(listener net.Listener) {
+			defer c.waitGroupStop.Done()
+
+			err := c.statusServer.Serve(listener)
+			if err != nil && err != http.ErrServerClosed {
+				c.log.Errorf("Error serving status api: %s", err)
+			}
+		}(listener)
+	}
+
+	return nil
+}
+
+func (c *Controller) stopStatusAPI() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := c.statusServer.Shutdown(ctx)
+	if err != nil {
+		c.log.Warnf("Error stopping status api: %s", err)
+	}
+}
@@ -0,0 +1,232 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+)
+
+// Prefix of check params overriding the thresholds of a value, in the format
+// "threshold.<value>.<minWarn|minCrit|maxWarn|maxCrit>"
+const thresholdParamPrefix = "threshold."
+
+var thresholdDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02",
+}
+
+// checkStatusSeverity orders the check statuses by severity
+var checkStatusSeverity = map[apiagent.CheckV1Status]int{
+	apiagent.CheckV1Status_CheckV1StatusOK:       0,
+	apiagent.CheckV1Status_CheckV1StatusWarning:  1,
+	apiagent.CheckV1Status_CheckV1StatusUnknown:  2,
+	apiagent.CheckV1Status_CheckV1StatusCritical: 3,
+}
+
+// worseCheckStatus returns the more severe of both statuses
+func worseCheckStatus(a apiagent.CheckV1Status, b apiagent.CheckV1Status) apiagent.CheckV1Status {
+	if checkStatusSeverity[b] > checkStatusSeverity[a] {
+		return b
+	}
+
+	return a
+}
+
+// splitThresholdParams separates the threshold overrides from the params
+// passed to the checker
+func splitThresholdParams(reqChecker *apiagent.CheckerV1, params []*apiagent.CheckV1Param) ([]*apiagent.CheckV1Param, map[string]*apiagent.CheckerV1Value, error) {
+	checkerParams := []*apiagent.CheckV1Param{}
+	overrides := map[string]*apiagent.CheckerV1Value{}
+
+	checkerValues := map[string]*apiagent.CheckerV1Value{}
+	for _, checkerValue := range reqChecker.Values {
+		checkerValues[checkerValue.Name] = checkerValue
+	}
+
+	for _, param := range params {
+		if !strings.HasPrefix(param.Name, thresholdParamPrefix) {
+			checkerParams = append(checkerParams, param)
+
+			continue
+		}
+
+		nameParts := strings.Split(strings.TrimPrefix(param.Name, thresholdParamPrefix), ".")
+		if len(nameParts) != 2 {
+			return nil, nil, fmt.Errorf("invalid parameter '%s': must have format %s<value>.<limit>", param.Name, thresholdParamPrefix)
+		}
+
+		checkerValue, ok := checkerValues[nameParts[0]]
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid parameter '%s': unknown value '%s'", param.Name, nameParts[0])
+		}
+
+		override, ok := overrides[nameParts[0]]
+		if !ok {
+			override = &apiagent.CheckerV1Value{
+				Name:    checkerValue.Name,
+				Type:    checkerValue.Type,
+				MinWarn: checkerValue.MinWarn,
+				MinCrit: checkerValue.MinCrit,
+				MaxWarn: checkerValue.MaxWarn,
+				MaxCrit: checkerValue.MaxCrit,
+			}
+
+			overrides[nameParts[0]] = override
+		}
+
+		switch nameParts[1] {
+		case "minWarn":
+			override.MinWarn = param.Value
+		case "minCrit":
+			override.MinCrit = param.Value
+		case "maxWarn":
+			override.MaxWarn = param.Value
+		case "maxCrit":
+			override.MaxCrit = param.Value
+		default:
+			return nil, nil, fmt.Errorf("invalid parameter '%s': unknown limit '%s'", param.Name, nameParts[1])
+		}
+
+		_, err := parseThresholdLimit(override.Type, param.Value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid parameter '%s': %s", param.Name, err)
+		}
+	}
+
+	return checkerParams, overrides, nil
+}
+
+// parseThresholdValue converts a value into a comparable number
+//
+// Dates are converted into the duration until the date, so they can be
+// compared with durations (e.g. "336h") or absolute dates
+func parseThresholdValue(valueType apiagent.CheckerV1ValueType, value string) (float64, error) {
+	switch valueType {
+	case apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber:
+		return strconv.ParseFloat(value, 64)
+	case apiagent.CheckerV1ValueType_CheckerV1ValueTypeDuration:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, err
+		}
+
+		return float64(duration), nil
+	case apiagent.CheckerV1ValueType_CheckerV1ValueTypeDate,
+		apiagent.CheckerV1ValueType_CheckerV1ValueTypeDateTime:
+		for _, layout := range thresholdDateLayouts {
+			date, err := time.Parse(layout, value)
+			if err == nil {
+				return float64(time.Until(date)), nil
+			}
+		}
+
+		return 0, fmt.Errorf("invalid date '%s'", value)
+	default:
+		return 0, fmt.Errorf("value type %s has no thresholds", valueType)
+	}
+}
+
+func parseThresholdLimit(valueType apiagent.CheckerV1ValueType, limit string) (float64, error) {
+	if valueType == apiagent.CheckerV1ValueType_CheckerV1ValueTypeDate ||
+		valueType == apiagent.CheckerV1ValueType_CheckerV1ValueTypeDateTime {
+		duration, err := time.ParseDuration(limit)
+		if err == nil {
+			return float64(duration), nil
+		}
+	}
+
+	return parseThresholdValue(valueType, limit)
+}
+
+// evaluateThreshold compares a value with the limits of a checker value,
+// limits are inclusive (e.g. "maxWarn: 80" warns at 80)
+func evaluateThreshold(checkerValue *apiagent.CheckerV1Value, value string) (apiagent.CheckV1Status, string, error) {
+	limits := []struct {
+		limit  string
+		max    bool
+		status apiagent.CheckV1Status
+	}{
+		{checkerValue.MinCrit, false, apiagent.CheckV1Status_CheckV1StatusCritical},
+		{checkerValue.MaxCrit, true, apiagent.CheckV1Status_CheckV1StatusCritical},
+		{checkerValue.MinWarn, false, apiagent.CheckV1Status_CheckV1StatusWarning},
+		{checkerValue.MaxWarn, true, apiagent.CheckV1Status_CheckV1StatusWarning},
+	}
+
+	parsedValue := 0.0
+	parsed := false
+
+	for _, limit := range limits {
+		if limit.limit == "" {
+			continue
+		}
+
+		if !parsed {
+			var err error
+
+			parsedValue, err = parseThresholdValue(checkerValue.Type, value)
+			if err != nil {
+				return apiagent.CheckV1Status_CheckV1StatusUnknown, "", fmt.Errorf("error parsing value %s '%s': %s", checkerValue.Name, value, err)
+			}
+
+			parsed = true
+		}
+
+		parsedLimit, err := parseThresholdLimit(checkerValue.Type, limit.limit)
+		if err != nil {
+			return apiagent.CheckV1Status_CheckV1StatusUnknown, "", fmt.Errorf("error parsing limit '%s' of value %s: %s", limit.limit, checkerValue.Name, err)
+		}
+
+		if limit.max && parsedValue >= parsedLimit {
+			return limit.status, fmt.Sprintf("%s %s >= %s", checkerValue.Name, value, limit.limit), nil
+		}
+
+		if !limit.max && parsedValue <= parsedLimit {
+			return limit.status, fmt.Sprintf("%s %s <= %s", checkerValue.Name, value, limit.limit), nil
+		}
+	}
+
+	return apiagent.CheckV1Status_CheckV1StatusOK, "", nil
+}
+
+// evaluateThresholds evaluates the limits of all values of a check result,
+// returning the most severe status and a description of all exceeded limits
+func evaluateThresholds(
+	reqChecker *apiagent.CheckerV1,
+	overrides map[string]*apiagent.CheckerV1Value,
+	values []*apiagent.CheckV1Value,
+) (apiagent.CheckV1Status, []string) {
+	status := apiagent.CheckV1Status_CheckV1StatusOK
+	messages := []string{}
+
+	checkerValues := map[string]*apiagent.CheckerV1Value{}
+	for _, checkerValue := range reqChecker.Values {
+		checkerValues[checkerValue.Name] = checkerValue
+	}
+	for name, override := range overrides {
+		checkerValues[name] = override
+	}
+
+	for _, value := range values {
+		checkerValue, ok := checkerValues[value.Name]
+		if !ok || value.Value == "" {
+			continue
+		}
+
+		valueStatus, message, err := evaluateThreshold(checkerValue, value.Value)
+		if err != nil {
+			message = err.Error()
+		}
+
+		if valueStatus == apiagent.CheckV1Status_CheckV1StatusOK {
+			continue
+		}
+
+		status = worseCheckStatus(status, valueStatus)
+		messages = append(messages, fmt.Sprintf("%s: %s", strings.TrimPrefix(valueStatus.String(), "CheckV1Status"), message))
+	}
+
+	return status, messages
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+)
+
+func TestEvaluateThresholds(t *testing.T) {
+	reqChecker := &apiagent.CheckerV1{
+		Values: []*apiagent.CheckerV1Value{
+			{
+				Name:    "used_percent",
+				Type:    apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+				MaxWarn: "80",
+				MaxCrit: "90",
+			},
+			{
+				Name:    "free",
+				Type:    apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+				MinWarn: "10",
+			},
+			{
+				Name:    "expires",
+				Type:    apiagent.CheckerV1ValueType_CheckerV1ValueTypeDateTime,
+				MinWarn: "336h",
+				MinCrit: "72h",
+			},
+			{
+				Name: "name",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeText,
+			},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		overrides    map[string]*apiagent.CheckerV1Value
+		values       []*apiagent.CheckV1Value
+		wantStatus   apiagent.CheckV1Status
+		wantMessages []string
+	}{
+		{
+			name: "ok",
+			values: []*apiagent.CheckV1Value{
+				{Name: "used_percent", Value: "79.9"},
+				{Name: "free", Value: "11"},
+				{Name: "name", Value: "test"},
+				{Name: "unknown", Value: "100"},
+			},
+			wantStatus:   apiagent.CheckV1Status_CheckV1StatusOK,
+			wantMessages: []string{},
+		},
+		{
+			name: "max limits are inclusive",
+			values: []*apiagent.CheckV1Value{
+				{Name: "used_percent", Value: "80"},
+			},
+			wantStatus:   apiagent.CheckV1Status_CheckV1StatusWarning,
+			wantMessages: []string{"Warning: used_percent 80 >= 80"},
+		},
+		{
+			name: "most severe status",
+			values: []*apiagent.CheckV1Value{
+				{Name: "free", Value: "10"},
+				{Name: "used_percent", Value: "95"},
+			},
+			wantStatus: apiagent.CheckV1Status_CheckV1StatusCritical,
+			wantMessages: []string{
+				"Warning: free 10 <= 10",
+				"Critical: used_percent 95 >= 90",
+			},
+		},
+		{
+			name: "override",
+			overrides: map[string]*apiagent.CheckerV1Value{
+				"used_percent": {
+					Name:    "used_percent",
+					Type:    apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+					MaxWarn: "96",
+				},
+			},
+			values: []*apiagent.CheckV1Value{
+				{Name: "used_percent", Value: "95"},
+			},
+			wantStatus:   apiagent.CheckV1Status_CheckV1StatusOK,
+			wantMessages: []string{},
+		},
+		{
+			name: "date",
+			values: []*apiagent.CheckV1Value{
+				{Name: "expires", Value: time.Now().Add(48 * time.Hour).Format(time.RFC3339Nano)},
+			},
+			wantStatus: apiagent.CheckV1Status_CheckV1StatusCritical,
+		},
+		{
+			name: "invalid value",
+			values: []*apiagent.CheckV1Value{
+				{Name: "used_percent", Value: "abc"},
+			},
+			wantStatus: apiagent.CheckV1Status_CheckV1StatusUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status, messages := evaluateThresholds(reqChecker, test.overrides, test.values)
+			if status != test.wantStatus {
+				t.Errorf("got status %s, want %s", status, test.wantStatus)
+			}
+
+			if test.wantMessages != nil && !reflect.DeepEqual(messages, test.wantMessages) {
+				t.Errorf("got messages %q, want %q", messages, test.wantMessages)
+			}
+		})
+	}
+}
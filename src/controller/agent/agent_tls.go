@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// loadPEM loads a pem either from a file or from a base64-encoded string
+func loadPEM(name string, filename string, base64PEM string) ([]byte, error) {
+	if filename != "" {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s from %s: %s", name, filename, err)
+		}
+
+		return data, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(base64PEM)
+	if err != nil {
+		return nil, fmt.Errorf("error base64-decoding %s: %s", name, err)
+	}
+
+	return data, nil
+}
+
+// clientCrtLoader provides the client certificate for tls handshakes,
+// reloading it when the certificate or key files change
+type clientCrtLoader struct {
+	crtFilename     string
+	keyFilename     string
+	mutex           sync.Mutex
+	crt             *tls.Certificate
+	notAfter        time.Time
+	crtFileModTime  time.Time
+	keyFileModTime  time.Time
+	lastReloadError error
+}
+
+func (l *clientCrtLoader) setCrt(crtPEM []byte, keyPEM []byte) error {
+	crt, err := tls.X509KeyPair(crtPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("error loading client certificate: %s", err)
+	}
+
+	leaf, err := x509.ParseCertificate(crt.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("error parsing client certificate: %s", err)
+	}
+
+	l.crt = &crt
+	l.notAfter = leaf.NotAfter
+
+	return nil
+}
+
+// Reload loads the certificate & key files if they changed since the last
+// load, returns true if a new certificate was loaded
+func (l *clientCrtLoader) Reload() (bool, error) {
+	if l.crtFilename == "" || l.keyFilename == "" {
+		return false, nil
+	}
+
+	crtFileStat, err := os.Stat(l.crtFilename)
+	if err != nil {
+		return false, fmt.Errorf("error loading client certificate file: %s", err)
+	}
+
+	keyFileStat, err := os.Stat(l.keyFilename)
+	if err != nil {
+		return false, fmt.Errorf("error loading client key file: %s", err)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if crtFileStat.ModTime().Equal(l.crtFileModTime) &&
+		keyFileStat.ModTime().Equal(l.keyFileModTime) {
+		return false, l.lastReloadError
+	}
+
+	// Don't retry loading the same files again
+	l.crtFileModTime = crtFileStat.ModTime()
+	l.keyFileModTime = keyFileStat.ModTime()
+
+	crtPEM, err := os.ReadFile(l.crtFilename)
+	if err != nil {
+		l.lastReloadError = fmt.Errorf("error reading client certificate file: %s", err)
+
+		return false, l.lastReloadError
+	}
+
+	keyPEM, err := os.ReadFile(l.keyFilename)
+	if err != nil {
+		l.lastReloadError = fmt.Errorf("error reading client key file: %s", err)
+
+		return false, l.lastReloadError
+	}
+
+	l.lastReloadError = l.setCrt(crtPEM, keyPEM)
+	if l.lastReloadError != nil {
+		return false, l.lastReloadError
+	}
+
+	return true, nil
+}
+
+// GetClientCertificate can be used as tls.Config.GetClientCertificate
+func (l *clientCrtLoader) GetClientCertificate(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	// Errors are ignored here, the previous certificate is used until the new files are valid
+	l.Reload()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.crt, nil
+}
+
+// NotAfter returns the expiry date of the current client certificate
+func (l *clientCrtLoader) NotAfter() time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.notAfter
+}
+
+func newClientCrtLoader(crtFilename string, keyFilename string, crtBase64 string, keyBase64 string) (*clientCrtLoader, error) {
+	l := &clientCrtLoader{
+		crtFilename: crtFilename,
+		keyFilename: keyFilename,
+	}
+
+	if crtFilename != "" || keyFilename != "" {
+		if crtFilename == "" || keyFilename == "" {
+			return nil, fmt.Errorf("client certificate and key must both be loaded from files")
+		}
+
+		_, err := l.Reload()
+		if err != nil {
+			return nil, err
+		}
+
+		return l, nil
+	}
+
+	crtPEM, err := loadPEM("client crt", "", crtBase64)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := loadPEM("client key", "", keyBase64)
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.setCrt(crtPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// checkClientCrt reloads the client certificate and warns if it is
+// about to expire
+func (c *Controller) checkClientCrt() {
+	reloaded, err := c.clientCrtLoader.Reload()
+	if err != nil {
+		c.log.Warnf("Error reloading client certificate: %s", err)
+	} else if reloaded {
+		c.log.Infof("Reloaded client certificate (valid until %s)", c.clientCrtLoader.NotAfter().Format(time.RFC3339))
+	}
+
+	expiresIn := time.Until(c.clientCrtLoader.NotAfter())
+	if expiresIn < *clientCrtExpiryWarning {
+		c.log.Warnf("Client certificate expires in %s (%s)", expiresIn.Round(time.Minute), c.clientCrtLoader.NotAfter().Format(time.RFC3339))
+	}
+}
+
+func (c *Controller) clientCrtLoop(ctx context.Context) {
+	c.checkClientCrt()
+
+	ticker := time.NewTicker(*clientCrtCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkClientCrt()
+		}
+	}
+}
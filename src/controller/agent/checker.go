@@ -2,13 +2,81 @@ package agent
 
 import (
 	"context"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/indece-official/monitor-agent-linux/src/utils"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type IChecker interface {
 	GetType() string
 	GetChecker() (*apiagent.CheckerV1, error)
 	GetChecks() ([]*apiagent.CheckV1, error)
-	Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error)
+	// Check runs a check, a returned error is reported with status critical
+	// unless another non-ok status is returned
+	Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error)
+}
+
+// checkerShortType returns the last segment of a checker type
+// (e.g. "disk" for "com.indece.agent.linux.v1.checker.disk")
+func checkerShortType(checkerType string) string {
+	return checkerType[strings.LastIndex(checkerType, ".")+1:]
+}
+
+// The value constructors fill the typed value and the formatted string value,
+// which is kept for backward compatibility
+
+func newCheckValueText(name string, value string) *apiagent.CheckV1Value {
+	return &apiagent.CheckV1Value{
+		Name:  name,
+		Value: value,
+	}
+}
+
+func newCheckValueInt(name string, value int64, unit string) *apiagent.CheckV1Value {
+	return &apiagent.CheckV1Value{
+		Name:       name,
+		Value:      fmt.Sprintf("%d", value),
+		TypedValue: &apiagent.CheckV1Value_IntValue{IntValue: value},
+		Unit:       unit,
+	}
+}
+
+// newCheckValueDouble creates a value formatted with the given number of decimals
+func newCheckValueDouble(name string, value float64, decimals int, unit string) *apiagent.CheckV1Value {
+	return &apiagent.CheckV1Value{
+		Name:       name,
+		Value:      fmt.Sprintf("%.*f", decimals, value),
+		TypedValue: &apiagent.CheckV1Value_DoubleValue{DoubleValue: value},
+		Unit:       unit,
+	}
+}
+
+// newCheckValueBool creates a value formatted as 1 or 0
+func newCheckValueBool(name string, value bool) *apiagent.CheckV1Value {
+	return &apiagent.CheckV1Value{
+		Name:       name,
+		Value:      fmt.Sprintf("%d", utils.BoolToInt(value)),
+		TypedValue: &apiagent.CheckV1Value_BoolValue{BoolValue: value},
+	}
+}
+
+func newCheckValueTime(name string, value time.Time) *apiagent.CheckV1Value {
+	return &apiagent.CheckV1Value{
+		Name:       name,
+		Value:      value.Format(time.RFC3339Nano),
+		TypedValue: &apiagent.CheckV1Value_TimestampValue{TimestampValue: timestamppb.New(value)},
+	}
+}
+
+func newCheckValueDuration(name string, value time.Duration) *apiagent.CheckV1Value {
+	return &apiagent.CheckV1Value{
+		Name:       name,
+		Value:      value.String(),
+		TypedValue: &apiagent.CheckV1Value_DurationValue{DurationValue: durationpb.New(value)},
+	}
 }
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/indece-official/monitor-agent-linux/src/utils"
+)
+
+const CheckerTypeAgent = "com.indece.agent.linux.v1.checker.agent"
+
+type AgentChecker struct {
+	clientCrtLoader *clientCrtLoader
+}
+
+func (c *AgentChecker) GetType() string {
+	return CheckerTypeAgent
+}
+
+func (c *AgentChecker) GetChecker() (*apiagent.CheckerV1, error) {
+	return &apiagent.CheckerV1{
+		Name:    "Agent",
+		Type:    CheckerTypeAgent,
+		Version: "",
+		Params:  []*apiagent.CheckerV1Param{},
+		Values: []*apiagent.CheckerV1Value{
+			{
+				Name:    "client_crt_expiry",
+				Type:    apiagent.CheckerV1ValueType_CheckerV1ValueTypeDuration,
+				MinWarn: "336h",
+				MinCrit: "72h",
+			},
+		},
+		// Run only once per hour
+		DefaultSchedule: "0 0 * * * *",
+	}, nil
+}
+
+func (c *AgentChecker) GetChecks() ([]*apiagent.CheckV1, error) {
+	return []*apiagent.CheckV1{
+		{
+			Name:        "Agent",
+			Type:        CheckerTypeAgent,
+			CheckerType: CheckerTypeAgent,
+			Params:      []*apiagent.CheckV1Param{},
+		},
+	}, nil
+}
+
+func (c *AgentChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	_, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	values := []*apiagent.CheckV1Value{}
+
+	notAfter := c.clientCrtLoader.NotAfter()
+	expiresIn := time.Until(notAfter)
+
+	values = append(values, newCheckValueDuration("client_crt_expiry", expiresIn))
+
+	if expiresIn <= 0 {
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", values, fmt.Errorf("client certificate expired at %s", notAfter.Format(time.RFC3339))
+	}
+
+	message := fmt.Sprintf(
+		"Client certificate expires in %s",
+		utils.FormatDurationPretty(expiresIn),
+	)
+
+	if expiresIn < *clientCrtExpiryWarning {
+		return apiagent.CheckV1Status_CheckV1StatusWarning, message, values, nil
+	}
+
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
+}
+
+var _ IChecker = (*AgentChecker)(nil)
+
+func NewAgentChecker(clientCrtLoader *clientCrtLoader) *AgentChecker {
+	return &AgentChecker{
+		clientCrtLoader: clientCrtLoader,
+	}
+}
@@ -5,11 +5,10 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
-	"strconv"
 	"strings"
 
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/indece-official/monitor-agent-linux/src/utils"
 )
 
 const CheckerTypeAptUpdates = "com.indece.agent.linux.v1.checker.aptupdates"
@@ -74,36 +73,21 @@ func (c *AptUpdatesChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	return checks, nil
 }
 
-func (c *AptUpdatesChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
-	var err error
-
-	paramExecAptUpdate := true
-
-	for _, param := range params {
-		if param.Value == "" {
-			continue
-		}
-
-		switch param.Name {
-		case "exec_apt_update":
-			paramExecAptUpdate, err = strconv.ParseBool(param.Value)
-			if err != nil {
-				return "", nil, fmt.Errorf("error parsing parameter '%s': %s", param.Name, err)
-			}
-		default:
-			return "", nil, fmt.Errorf("unknown parameter '%s'", param.Name)
-		}
+func (c *AptUpdatesChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
 	}
 
-	if paramExecAptUpdate {
-		cmdUpdate := exec.Command("/usr/bin/apt", "update")
+	if checkParams.Bool("exec_apt_update", true) {
+		cmdUpdate := utils.CommandContext(ctx, "/usr/bin/apt", "update")
 		out, err := cmdUpdate.Output()
 		if err != nil {
-			return "", nil, fmt.Errorf("error running apt update: %s (%s)", err, string(out))
+			return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error running apt update: %s (%s)", err, string(out))
 		}
 	}
 
-	cmdCheck := exec.Command("/usr/bin/apt", "list", "--upgradable")
+	cmdCheck := utils.CommandContext(ctx, "/usr/bin/apt", "list", "--upgradable")
 	stdoutCheck := bytes.Buffer{}
 	stderrCheck := bytes.Buffer{}
 
@@ -113,7 +97,7 @@ func (c *AptUpdatesChecker) Check(ctx context.Context, params []*apiagent.CheckV
 	out := stdoutCheck.String() + stderrCheck.String()
 
 	if err != nil {
-		return "", nil, fmt.Errorf("error running apt-check: %s (%s)", err, out)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error running apt-check: %s (%s)", err, out)
 	}
 
 	countAvailable := int64(0)
@@ -145,15 +129,9 @@ func (c *AptUpdatesChecker) Check(ctx context.Context, params []*apiagent.CheckV
 
 	values := []*apiagent.CheckV1Value{}
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "count_available",
-		Value: fmt.Sprintf("%d", countAvailable),
-	})
+	values = append(values, newCheckValueInt("count_available", countAvailable, ""))
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "count_security",
-		Value: fmt.Sprintf("%d", countSecurity),
-	})
+	values = append(values, newCheckValueInt("count_security", countSecurity, ""))
 
 	message := ""
 
@@ -167,7 +145,7 @@ func (c *AptUpdatesChecker) Check(ctx context.Context, params []*apiagent.CheckV
 		)
 	}
 
-	return message, values, nil
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
 }
 
 var _ IChecker = (*AptUpdatesChecker)(nil)
@@ -73,53 +73,37 @@ func (c *CpuChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	}, nil
 }
 
-func (c *CpuChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
-	l, err := load.Avg()
+func (c *CpuChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	_, err := bindCheckParams(c, params)
 	if err != nil {
-		return "", nil, fmt.Errorf("error loading load stats: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
 	}
 
-	count, err := cpu.Counts(true)
+	l, err := load.AvgWithContext(ctx)
 	if err != nil {
-		return "", nil, fmt.Errorf("error loading number of cpus: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading load stats: %s", err)
+	}
+
+	count, err := cpu.CountsWithContext(ctx, true)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading number of cpus: %s", err)
 	}
 
 	values := []*apiagent.CheckV1Value{}
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "count",
-		Value: fmt.Sprintf("%d", count),
-	})
-
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "load_1",
-		Value: fmt.Sprintf("%.2f", l.Load1),
-	})
-
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "load_5",
-		Value: fmt.Sprintf("%.2f", l.Load5),
-	})
-
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "load_15",
-		Value: fmt.Sprintf("%.2f", l.Load15),
-	})
-
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "load_1_percent",
-		Value: fmt.Sprintf("%.2f", (l.Load1/math.Max(float64(count), 1))*100.0),
-	})
-
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "load_5_percent",
-		Value: fmt.Sprintf("%.2f", (l.Load5/math.Max(float64(count), 1))*100.0),
-	})
-
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "load_15_percent",
-		Value: fmt.Sprintf("%.2f", (l.Load15/math.Max(float64(count), 1))*100.0),
-	})
+	values = append(values, newCheckValueInt("count", int64(count), ""))
+
+	values = append(values, newCheckValueDouble("load_1", l.Load1, 2, ""))
+
+	values = append(values, newCheckValueDouble("load_5", l.Load5, 2, ""))
+
+	values = append(values, newCheckValueDouble("load_15", l.Load15, 2, ""))
+
+	values = append(values, newCheckValueDouble("load_1_percent", (l.Load1/math.Max(float64(count), 1))*100.0, 2, "%"))
+
+	values = append(values, newCheckValueDouble("load_5_percent", (l.Load5/math.Max(float64(count), 1))*100.0, 2, "%"))
+
+	values = append(values, newCheckValueDouble("load_15_percent", (l.Load15/math.Max(float64(count), 1))*100.0, 2, "%"))
 
 	message := fmt.Sprintf(
 		"Load(1) = %.2f, Load(5) = %.2f, Load(15) = %.2f for %d cores",
@@ -129,7 +113,7 @@ func (c *CpuChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param)
 		count,
 	)
 
-	return message, values, nil
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
 }
 
 var _ IChecker = (*CpuChecker)(nil)
@@ -7,12 +7,12 @@ import (
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
 	"github.com/indece-official/monitor-agent-linux/src/utils"
 	"github.com/shirou/gopsutil/disk"
-	"gopkg.in/guregu/null.v4"
 )
 
 const CheckerTypeDisk = "com.indece.agent.linux.v1.checker.disk"
 
 type DiskChecker struct {
+	ignoreFstypes map[string]bool
 }
 
 func (c *DiskChecker) GetType() string {
@@ -62,8 +62,8 @@ func (c *DiskChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	mapDevices := map[string]bool{}
 
 	for _, partition := range partitions {
-		if partition.Fstype == "squashfs" {
-			// Ignore squashfs
+		if c.ignoreFstypes[partition.Fstype] {
+			// Ignore e.g. squashfs
 			continue
 		}
 
@@ -92,65 +92,44 @@ func (c *DiskChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	return checks, nil
 }
 
-func (c *DiskChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
-	paramMountpoint := null.String{}
-
-	for _, param := range params {
-		if param.Value == "" {
-			continue
-		}
-
-		switch param.Name {
-		case "mountpoint":
-			paramMountpoint.Scan(param.Value)
-		default:
-			return "", nil, fmt.Errorf("unknown parameter '%s'", param.Name)
-		}
+func (c *DiskChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
 	}
 
-	if !paramMountpoint.Valid || paramMountpoint.String == "" {
-		return "", nil, fmt.Errorf("missing parameter 'mountpoint'")
-	}
+	paramMountpoint := checkParams.String("mountpoint", "")
 
 	values := []*apiagent.CheckV1Value{}
 
-	partitions, err := disk.Partitions(false)
+	partitions, err := disk.PartitionsWithContext(ctx, false)
 	if err != nil {
-		return "", values, fmt.Errorf("error loading partition list: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", values, fmt.Errorf("error loading partition list: %s", err)
 	}
 
 	var partition *disk.PartitionStat
 
 	for _, p := range partitions {
-		if p.Mountpoint == paramMountpoint.String {
+		if p.Mountpoint == paramMountpoint {
 			partition = &p
 			break
 		}
 	}
 
 	if partition == nil {
-		return "", values, fmt.Errorf("error partition not found")
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", values, fmt.Errorf("error partition not found")
 	}
 
-	usage, err := disk.Usage(paramMountpoint.String)
+	usage, err := disk.UsageWithContext(ctx, paramMountpoint)
 	if err != nil {
-		return "", values, fmt.Errorf("error loading partition stats: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", values, fmt.Errorf("error loading partition stats: %s", err)
 	}
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "total",
-		Value: fmt.Sprintf("%d", usage.Total),
-	})
+	values = append(values, newCheckValueInt("total", int64(usage.Total), "B"))
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "used",
-		Value: fmt.Sprintf("%d", usage.Used),
-	})
+	values = append(values, newCheckValueInt("used", int64(usage.Used), "B"))
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "used_percent",
-		Value: fmt.Sprintf("%.0f", usage.UsedPercent),
-	})
+	values = append(values, newCheckValueDouble("used_percent", usage.UsedPercent, 0, "%"))
 
 	message := fmt.Sprintf(
 		"%.1f%% (%s of %s) used of filesystem %s mounted on %s (%s)",
@@ -162,11 +141,19 @@ func (c *DiskChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param
 		usage.Fstype,
 	)
 
-	return message, values, nil
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
 }
 
 var _ IChecker = (*DiskChecker)(nil)
 
-func NewDiskChecker() *DiskChecker {
-	return &DiskChecker{}
+func NewDiskChecker(ignoreFstypes []string) *DiskChecker {
+	c := &DiskChecker{
+		ignoreFstypes: map[string]bool{},
+	}
+
+	for _, fstype := range ignoreFstypes {
+		c.ignoreFstypes[fstype] = true
+	}
+
+	return c
 }
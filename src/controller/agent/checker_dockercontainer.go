@@ -9,7 +9,6 @@ import (
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
-	"gopkg.in/guregu/null.v4"
 )
 
 const CheckerTypeDockerContainer = "com.indece.agent.linux.v1.checker.dockercontainer"
@@ -48,44 +47,30 @@ func (c *DockerContainerChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	return []*apiagent.CheckV1{}, nil
 }
 
-func (c *DockerContainerChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
-	var err error
-
-	paramName := null.String{}
-
-	for _, param := range params {
-		if param.Value == "" {
-			continue
-		}
-
-		switch param.Name {
-		case "name":
-			paramName.Scan(param.Value)
-		default:
-			return "", nil, fmt.Errorf("unknown parameter '%s'", param.Name)
-		}
+func (c *DockerContainerChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
 	}
 
-	if !paramName.Valid || paramName.String == "" {
-		return "", nil, fmt.Errorf("missing parameter 'name'")
-	}
+	paramName := checkParams.String("name", "")
 
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
-		return "", nil, fmt.Errorf("error connecting to docker daemon: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error connecting to docker daemon: %s", err)
 	}
 
 	opts := types.ContainerListOptions{All: true}
 	opts.Filters = filters.NewArgs()
-	opts.Filters.Add("name", paramName.String)
+	opts.Filters.Add("name", paramName)
 
 	containers, err := cli.ContainerList(ctx, opts)
 	if err != nil {
-		return "", nil, fmt.Errorf("error loading containers from docker daemon: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading containers from docker daemon: %s", err)
 	}
 
 	if len(containers) == 0 {
-		return "", nil, fmt.Errorf("docker container %s not found", paramName.String)
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", nil, fmt.Errorf("docker container %s not found", paramName)
 	}
 
 	container := containers[0]
@@ -99,23 +84,36 @@ func (c *DockerContainerChecker) Check(ctx context.Context, params []*apiagent.C
 
 	state, err := cli.ContainerInspect(ctx, container.ID)
 	if err != nil {
-		return "", nil, fmt.Errorf("error inspecting container %s (%s): %s", name, containerID, err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error inspecting container %s (%s): %s", name, containerID, err)
 	}
 
 	// "created", "running", "paused", "restarting", "removing", "exited", "dead":
 	if state.State.Status != "running" {
-		return "", nil, fmt.Errorf("docker container %s (%s) is in state %s (%s): %s", name, containerID, state.State.Status, container.Image, state.State.Error)
-	}
-
-	// Starting, Healthy or Unhealthy
-	if state.State.Health != nil && state.State.Health.Status != "Healthy" {
-		return "", nil, fmt.Errorf("docker container %s (%s) is running but has health status %s (%s): %s", name, containerID, state.State.Health.Status, container.Image, state.State.Error)
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", nil, fmt.Errorf("docker container %s (%s) is in state %s (%s): %s", name, containerID, state.State.Status, container.Image, state.State.Error)
 	}
 
 	values := []*apiagent.CheckV1Value{}
 
+	// Starting, healthy or unhealthy
+	if state.State.Health != nil && state.State.Health.Status != types.Healthy {
+		status := apiagent.CheckV1Status_CheckV1StatusWarning
+		if state.State.Health.Status == types.Starting {
+			status = apiagent.CheckV1Status_CheckV1StatusUnknown
+		}
+
+		message := fmt.Sprintf(
+			"Docker container %s (%s) is running but has health status %s (%s)",
+			name,
+			containerID,
+			state.State.Health.Status,
+			container.Image,
+		)
+
+		return status, message, values, nil
+	}
+
 	healthMessage := ""
-	if state.State.Health != nil && state.State.Health.Status == "Healthy" {
+	if state.State.Health != nil {
 		healthMessage = "and healthy "
 	}
 
@@ -127,7 +125,7 @@ func (c *DockerContainerChecker) Check(ctx context.Context, params []*apiagent.C
 		container.Image,
 	)
 
-	return message, values, nil
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
 }
 
 var _ IChecker = (*DockerContainerChecker)(nil)
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strconv"
 	"time"
 
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
@@ -90,33 +89,14 @@ func (c *FileChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	return []*apiagent.CheckV1{}, nil
 }
 
-func (c *FileChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
-	paramPath := null.String{}
-	paramCalcMD5 := false
-
-	var err error
-
-	for _, param := range params {
-		if param.Value == "" {
-			continue
-		}
-
-		switch param.Name {
-		case "path":
-			paramPath.Scan(param.Value)
-		case "calc_md5":
-			paramCalcMD5, err = strconv.ParseBool(param.Value)
-			if err != nil {
-				return "", nil, fmt.Errorf("error parsing parameter '%s': %s", param.Name, err)
-			}
-		default:
-			return "", nil, fmt.Errorf("unknown parameter '%s'", param.Name)
-		}
+func (c *FileChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
 	}
 
-	if !paramPath.Valid || paramPath.String == "" {
-		return "", nil, fmt.Errorf("missing parameter 'path'")
-	}
+	paramPath := checkParams.String("path", "")
+	paramCalcMD5 := checkParams.Bool("calc_md5", false)
 
 	values := []*apiagent.CheckV1Value{}
 
@@ -124,69 +104,57 @@ func (c *FileChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param
 	size := int64(0)
 	createdAt := null.Time{}
 	messageError := ""
+	status := apiagent.CheckV1Status_CheckV1StatusOK
 
-	fileStat, err := os.Stat(paramPath.String)
+	fileStat, err := os.Stat(paramPath)
 	if err != nil {
 		messageError = err.Error()
+		status = apiagent.CheckV1Status_CheckV1StatusCritical
 	} else {
 		exists = true
 		size = fileStat.Size()
 		createdAt.Scan(fileStat.ModTime())
 	}
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "exists",
-		Value: fmt.Sprintf("%d", utils.BoolToInt(exists)),
-	})
+	values = append(values, newCheckValueBool("exists", exists))
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "size",
-		Value: fmt.Sprintf("%d", size),
-	})
+	values = append(values, newCheckValueInt("size", size, "B"))
 
 	if createdAt.Valid {
-		values = append(values, &apiagent.CheckV1Value{
-			Name:  "created_at",
-			Value: createdAt.Time.Format(time.RFC3339Nano),
-		})
-
-		values = append(values, &apiagent.CheckV1Value{
-			Name:  "age",
-			Value: time.Since(createdAt.Time).String(),
-		})
+		values = append(values, newCheckValueTime("created_at", createdAt.Time))
+
+		values = append(values, newCheckValueDuration("age", time.Since(createdAt.Time)))
 	}
 
 	md5sum := ""
 
 	if exists && paramCalcMD5 {
-		md5sum, err = c.md5sum(paramPath.String)
+		md5sum, err = c.md5sum(paramPath)
 		if err != nil {
 			messageError = err.Error()
+			status = apiagent.CheckV1Status_CheckV1StatusUnknown
 		}
 	}
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "md5",
-		Value: md5sum,
-	})
+	values = append(values, newCheckValueText("md5", md5sum))
 
 	message := ""
 
 	if messageError == "" {
 		message = fmt.Sprintf(
 			"File %s found (%s)",
-			paramPath.String,
+			paramPath,
 			utils.FormatBytes(size),
 		)
 	} else {
 		message = fmt.Sprintf(
 			"Error checking file %s: %s",
-			paramPath.String,
+			paramPath,
 			messageError,
 		)
 	}
 
-	return message, values, nil
+	return status, message, values, nil
 }
 
 var _ IChecker = (*FileChecker)(nil)
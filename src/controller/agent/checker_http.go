@@ -6,13 +6,11 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
 	"github.com/indece-official/monitor-agent-linux/src/utils"
-	"gopkg.in/guregu/null.v4"
 )
 
 const CheckerTypeHttp = "com.indece.agent.linux.v1.checker.http"
@@ -78,41 +76,18 @@ func (c *HttpChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	return []*apiagent.CheckV1{}, nil
 }
 
-func (c *HttpChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
-	var err error
-
-	paramURL := null.String{}
-	paramDNS := null.String{}
-	paramTimeout := 5 * time.Second
-	paramExpectedStatus := int64(200)
-
-	for _, param := range params {
-		if param.Value == "" {
-			continue
-		}
-
-		switch param.Name {
-		case "url":
-			paramURL.Scan(param.Value)
-		case "dns":
-			paramDNS.Scan(param.Value)
-		case "timeout":
-			paramTimeout, err = time.ParseDuration(param.Value)
-			if err != nil {
-				return "", nil, fmt.Errorf("error parsing parameter 'timeout': %s", err)
-			}
-		case "status":
-			paramExpectedStatus, err = strconv.ParseInt(param.Value, 10, 64)
-			if err != nil {
-				return "", nil, fmt.Errorf("error parsing parameter 'status': %s", err)
-			}
-		default:
-			return "", nil, fmt.Errorf("unknown parameter '%s'", param.Name)
-		}
+func (c *HttpChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
 	}
 
-	if !paramURL.Valid || paramURL.String == "" {
-		return "", nil, fmt.Errorf("missing parameter 'url'")
+	paramURL := checkParams.String("url", "")
+	paramDNS := checkParams.String("dns", "")
+	paramTimeout := checkParams.Duration("timeout", 5*time.Second)
+	paramExpectedStatus, err := checkParams.Int("status", 200)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
 	}
 
 	client := http.Client{
@@ -120,13 +95,13 @@ func (c *HttpChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param
 			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
 				var err error
 
-				if paramDNS.Valid && paramDNS.String != "" {
+				if paramDNS != "" {
 					addrParts := strings.Split(addr, ":")
 					if len(addrParts) != 2 {
 						return nil, fmt.Errorf("error parsing address '%s': must have format <host>:<port>", addr)
 					}
 
-					addrParts[0], err = utils.ResolveDNS(addrParts[0], paramDNS.String)
+					addrParts[0], err = utils.ResolveDNS(addrParts[0], paramDNS)
 					if err != nil {
 						return nil, err
 					}
@@ -134,7 +109,9 @@ func (c *HttpChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param
 					addr = strings.Join(addrParts, ":")
 				}
 
-				return net.Dial(network, addr)
+				dialer := net.Dialer{}
+
+				return dialer.DialContext(ctx, network, addr)
 			},
 		},
 		Timeout: paramTimeout,
@@ -144,55 +121,48 @@ func (c *HttpChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param
 
 	values := []*apiagent.CheckV1Value{}
 
-	resp, err := client.Get(paramURL.String)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, paramURL, nil)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", values, fmt.Errorf("error building request for '%s': %s", paramURL, err)
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", values, fmt.Errorf("error getting '%s': %s", paramURL.String, err)
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", values, fmt.Errorf("error getting '%s': %s", paramURL, err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", values, fmt.Errorf("error reading response body from '%s': %s", paramURL.String, err)
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", values, fmt.Errorf("error reading response body from '%s': %s", paramURL, err)
 	}
 
 	responseTime := time.Since(startAt)
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "resp_time",
-		Value: responseTime.String(),
-	})
+	values = append(values, newCheckValueDuration("resp_time", responseTime))
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "status_code",
-		Value: fmt.Sprintf("%d", resp.StatusCode),
-	})
+	values = append(values, newCheckValueInt("status_code", int64(resp.StatusCode), ""))
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "resp_size",
-		Value: fmt.Sprintf("%d", len(body)),
-	})
+	values = append(values, newCheckValueInt("resp_size", int64(len(body)), "B"))
 
 	if resp.StatusCode != int(paramExpectedStatus) {
-		return "", values, fmt.Errorf("error getting '%s' - %s (expected status %d)", paramURL.String, resp.Status, paramExpectedStatus)
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", values, fmt.Errorf("error getting '%s' - %s (expected status %d)", paramURL, resp.Status, paramExpectedStatus)
 	}
 
 	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
 		now := time.Now()
 		duration := resp.TLS.PeerCertificates[0].NotAfter.Sub(now)
 
-		values = append(values, &apiagent.CheckV1Value{
-			Name:  "tls_expiry",
-			Value: duration.String(),
-		})
+		values = append(values, newCheckValueDuration("tls_expiry", duration))
 	}
 
 	message := fmt.Sprintf(
 		"GET '%s' - %s\n",
-		paramURL.String,
+		paramURL,
 		resp.Status,
 	)
 
-	return message, values, nil
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
 }
 
 var _ IChecker = (*HttpChecker)(nil)
@@ -0,0 +1,400 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/indece-official/monitor-agent-linux/src/utils"
+)
+
+const CheckerTypeJournal = "com.indece.agent.linux.v1.checker.journal"
+
+// Syslog priorities supported by journalctl -p
+var journalPriorities = []string{
+	"emerg",
+	"alert",
+	"crit",
+	"err",
+	"warning",
+	"notice",
+	"info",
+	"debug",
+}
+
+// journalEntry contains the fields of a journal entry
+type journalEntry map[string]string
+
+// parseJournalExport parses entries in the journal export format
+// (see https://systemd.io/JOURNAL_EXPORT_FORMATS/) and calls fn for
+// each entry
+func parseJournalExport(r io.Reader, fn func(entry journalEntry) error) error {
+	reader := bufio.NewReader(r)
+	entry := journalEntry{}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		line = bytes.TrimSuffix(line, []byte("\n"))
+
+		if len(line) == 0 {
+			// Entries are separated by an empty line
+			if len(entry) > 0 {
+				err = fn(entry)
+				if err != nil {
+					return err
+				}
+			}
+
+			entry = journalEntry{}
+
+			continue
+		}
+
+		name, value, ok := bytes.Cut(line, []byte("="))
+		if ok {
+			entry[string(name)] = string(value)
+
+			continue
+		}
+
+		// Binary fields are followed by their size as little endian uint64,
+		// the data and a newline
+		size := uint64(0)
+		err = binary.Read(reader, binary.LittleEndian, &size)
+		if err != nil {
+			return fmt.Errorf("error reading size of field %s: %s", name, err)
+		}
+
+		data := make([]byte, size+1)
+		_, err = io.ReadFull(reader, data)
+		if err != nil {
+			return fmt.Errorf("error reading field %s: %s", name, err)
+		}
+
+		entry[string(name)] = string(data[:size])
+	}
+
+	if len(entry) > 0 {
+		return fn(entry)
+	}
+
+	return nil
+}
+
+// journalMatches collects the matching entries of the journal
+//
+// The entries are filtered here instead of by journalctl, so the cursor
+// always points to the last entry of the journal
+type journalMatches struct {
+	unit        string
+	maxPriority int
+	pattern     *regexp.Regexp
+	maxSamples  int
+	count       int64
+	entries     int64
+	samples     []string
+	cursor      string
+}
+
+// journalUnitName completes a unit name without type like journalctl -u
+func journalUnitName(unit string) string {
+	if unit == "" || strings.Contains(unit, ".") {
+		return unit
+	}
+
+	return unit + ".service"
+}
+
+// journalPriority returns the numeric value of a priority name, or -1 for
+// all priorities if the name is empty
+func journalPriority(name string) (int, error) {
+	if name == "" {
+		return -1, nil
+	}
+
+	for i, priority := range journalPriorities {
+		if priority == name {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown priority '%s'", name)
+}
+
+// formatJournalEntry formats an entry similar to journalctl -o short
+func formatJournalEntry(entry journalEntry) string {
+	sample := ""
+
+	realtime, err := strconv.ParseInt(entry["__REALTIME_TIMESTAMP"], 10, 64)
+	if err == nil {
+		sample = time.UnixMicro(realtime).Format(time.RFC3339) + " "
+	}
+
+	identifier := entry["SYSLOG_IDENTIFIER"]
+	if identifier == "" {
+		identifier = entry["_SYSTEMD_UNIT"]
+	}
+
+	if identifier != "" {
+		sample += identifier + ": "
+	}
+
+	return sample + strings.TrimSpace(entry["MESSAGE"])
+}
+
+func (m *journalMatches) add(entry journalEntry) error {
+	if entry["__CURSOR"] != "" {
+		m.cursor = entry["__CURSOR"]
+	}
+
+	if m.unit != "" && entry["_SYSTEMD_UNIT"] != m.unit && entry["UNIT"] != m.unit {
+		// UNIT is set for messages of systemd about the unit
+		return nil
+	}
+
+	if m.maxPriority >= 0 {
+		priority, err := strconv.Atoi(entry["PRIORITY"])
+		if err != nil || priority > m.maxPriority {
+			return nil
+		}
+	}
+
+	m.entries++
+
+	if m.pattern != nil && !m.pattern.MatchString(entry["MESSAGE"]) {
+		return nil
+	}
+
+	m.count++
+
+	if m.maxSamples <= 0 {
+		return nil
+	}
+
+	m.samples = append(m.samples, formatJournalEntry(entry))
+	if len(m.samples) > m.maxSamples {
+		m.samples = m.samples[1:]
+	}
+
+	return nil
+}
+
+// JournalChecker counts the entries of the systemd journal matching a unit,
+// priority and pattern since the previous check
+//
+// The journal cursor is stored in the state of the check, so no entries are
+// missed or counted twice across restarts of the agent
+type JournalChecker struct {
+}
+
+func (c *JournalChecker) GetType() string {
+	return CheckerTypeJournal
+}
+
+func (c *JournalChecker) GetChecker() (*apiagent.CheckerV1, error) {
+	return &apiagent.CheckerV1{
+		Name:         "Journal",
+		Type:         CheckerTypeJournal,
+		Version:      "",
+		CustomChecks: true,
+		Params: []*apiagent.CheckerV1Param{
+			{
+				Name:  "unit",
+				Label: "Unit",
+				Hint:  "All units are checked if empty",
+				Type:  apiagent.CheckerV1ParamType_CheckerV1ParamTypeText,
+			},
+			{
+				Name:    "priority",
+				Label:   "Max. priority",
+				Hint:    "Entries with this or a higher priority are checked",
+				Type:    apiagent.CheckerV1ParamType_CheckerV1ParamTypeSelect,
+				Options: journalPriorities,
+			},
+			{
+				Name:  "pattern",
+				Label: "Message pattern",
+				Hint:  "Regular expression, all entries are counted if empty",
+				Type:  apiagent.CheckerV1ParamType_CheckerV1ParamTypeText,
+			},
+			{
+				Name:  "max_samples",
+				Label: "Max. entries in message",
+				Type:  apiagent.CheckerV1ParamType_CheckerV1ParamTypeNumber,
+			},
+		},
+		Values: []*apiagent.CheckerV1Value{
+			{
+				Name:    "matches",
+				Type:    apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+				MaxWarn: "1",
+			},
+			{
+				Name: "entries",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+			{
+				Name: "last_match",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeText,
+			},
+		},
+	}, nil
+}
+
+func (c *JournalChecker) GetChecks() ([]*apiagent.CheckV1, error) {
+	return []*apiagent.CheckV1{}, nil
+}
+
+// readJournal runs journalctl and passes the exported entries to fn
+func readJournal(ctx context.Context, args []string, fn func(entry journalEntry) error) error {
+	args = append(
+		[]string{
+			"--output=export",
+			"--no-pager",
+			"--output-fields=MESSAGE,PRIORITY,SYSLOG_IDENTIFIER,_SYSTEMD_UNIT,UNIT",
+		},
+		args...,
+	)
+
+	cmd := utils.CommandContext(ctx, "journalctl", args...)
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("error running journalctl: %s", err)
+	}
+
+	err = parseJournalExport(stdout, fn)
+	if err != nil {
+		// Unblock journalctl before waiting for it
+		_, _ = io.Copy(io.Discard, stdout)
+		_ = cmd.Wait()
+
+		return fmt.Errorf("error parsing output of journalctl: %s", err)
+	}
+
+	err = cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("error running journalctl: %s (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+func (c *JournalChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	paramUnit := checkParams.String("unit", "")
+	paramPriority := checkParams.String("priority", "")
+	paramPattern := checkParams.String("pattern", "")
+
+	paramMaxSamples, err := checkParams.Int("max_samples", 5)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	matches := &journalMatches{
+		unit:       journalUnitName(paramUnit),
+		maxSamples: int(paramMaxSamples),
+	}
+
+	matches.maxPriority, err = journalPriority(paramPriority)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("invalid value for parameter 'priority': %s", err)
+	}
+
+	if paramPattern != "" {
+		matches.pattern, err = regexp.Compile(paramPattern)
+		if err != nil {
+			return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("invalid value for parameter 'pattern': %s", err)
+		}
+	}
+
+	state := checkStateFromContext(ctx)
+
+	cursor := ""
+
+	_, err = state.Get("cursor", &cursor)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading cursor: %s", err)
+	}
+
+	if cursor == "" {
+		// Start at the end of the journal on the first check, so old entries
+		// are not reported
+		last := &journalMatches{}
+
+		err = readJournal(ctx, []string{"--lines=1"}, last.add)
+		if err != nil {
+			return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+		}
+
+		matches.cursor = last.cursor
+	} else {
+		matches.cursor = cursor
+
+		err = readJournal(ctx, []string{fmt.Sprintf("--after-cursor=%s", cursor)}, matches.add)
+		if err != nil {
+			return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+		}
+	}
+
+	if matches.cursor != "" {
+		err = state.Set("cursor", matches.cursor)
+		if err != nil {
+			return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error storing cursor: %s", err)
+		}
+	}
+
+	values := []*apiagent.CheckV1Value{}
+
+	values = append(values, newCheckValueInt("matches", matches.count, ""))
+
+	values = append(values, newCheckValueInt("entries", matches.entries, ""))
+
+	if len(matches.samples) > 0 {
+		values = append(values, newCheckValueText("last_match", matches.samples[len(matches.samples)-1]))
+	}
+
+	message := fmt.Sprintf(
+		"%d of %d new journal entries matched",
+		matches.count,
+		matches.entries,
+	)
+
+	if len(matches.samples) > 0 {
+		message = fmt.Sprintf("%s, last:\n%s", message, strings.Join(matches.samples, "\n"))
+	}
+
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
+}
+
+var _ IChecker = (*JournalChecker)(nil)
+
+func NewJournalChecker() *JournalChecker {
+	return &JournalChecker{}
+}
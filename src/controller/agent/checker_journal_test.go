@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJournalExport(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []journalEntry
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			input: "",
+			want:  []journalEntry{},
+		},
+		{
+			name:  "multiple fields",
+			input: "__CURSOR=s=1;i=1\nPRIORITY=3\nMESSAGE=a=b\n\n",
+			want: []journalEntry{
+				{"__CURSOR": "s=1;i=1", "PRIORITY": "3", "MESSAGE": "a=b"},
+			},
+		},
+		{
+			name:  "multiple entries without trailing newline",
+			input: "MESSAGE=first\n\nMESSAGE=second\n",
+			want: []journalEntry{
+				{"MESSAGE": "first"},
+				{"MESSAGE": "second"},
+			},
+		},
+		{
+			name:  "binary field",
+			input: "PRIORITY=6\nMESSAGE\n\x05\x00\x00\x00\x00\x00\x00\x00a\nb\x00c\n\n",
+			want: []journalEntry{
+				{"PRIORITY": "6", "MESSAGE": "a\nb\x00c"},
+			},
+		},
+		{
+			name:    "truncated binary field",
+			input:   "MESSAGE\n\x05\x00\x00\x00\x00\x00\x00\x00ab",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := []journalEntry{}
+
+			err := parseJournalExport(strings.NewReader(test.input), func(entry journalEntry) error {
+				entries = append(entries, entry)
+
+				return nil
+			})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if !test.wantErr && !reflect.DeepEqual(entries, test.want) {
+				t.Errorf("got %v, want %v", entries, test.want)
+			}
+		})
+	}
+}
+
+// journalTestSample formats a sample of testdata/journal.export in the local
+// time zone
+func journalTestSample(second int64, text string) string {
+	return time.Unix(1700000000+second, 0).Format(time.RFC3339) + " " + text
+}
+
+func TestJournalMatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		unit        string
+		priority    string
+		pattern     string
+		wantCount   int64
+		wantEntries int64
+		wantSamples []string
+	}{
+		{
+			name:        "all",
+			wantCount:   4,
+			wantEntries: 4,
+			wantSamples: []string{
+				journalTestSample(2, "systemd: Started ssh.service"),
+				journalTestSample(3, "kernel: error: disk almost full"),
+			},
+		},
+		{
+			name:        "priority",
+			priority:    "warning",
+			wantCount:   2,
+			wantEntries: 2,
+			wantSamples: []string{
+				journalTestSample(0, "sshd: error: connection reset by peer"),
+				journalTestSample(3, "kernel: error: disk almost full"),
+			},
+		},
+		{
+			name:        "priority err",
+			priority:    "err",
+			wantCount:   1,
+			wantEntries: 1,
+			wantSamples: []string{
+				journalTestSample(0, "sshd: error: connection reset by peer"),
+			},
+		},
+		{
+			name:        "unit",
+			unit:        "ssh",
+			wantCount:   3,
+			wantEntries: 3,
+			wantSamples: []string{
+				journalTestSample(1, "sshd: Accepted publickey\nfor root"),
+				journalTestSample(2, "systemd: Started ssh.service"),
+			},
+		},
+		{
+			name:        "unit and pattern",
+			unit:        "ssh.service",
+			pattern:     "^error",
+			wantCount:   1,
+			wantEntries: 3,
+			wantSamples: []string{
+				journalTestSample(0, "sshd: error: connection reset by peer"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := os.Open("testdata/journal.export")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			matches := &journalMatches{
+				unit:       journalUnitName(test.unit),
+				maxSamples: 2,
+			}
+
+			matches.maxPriority, err = journalPriority(test.priority)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.pattern != "" {
+				matches.pattern = regexp.MustCompile(test.pattern)
+			}
+
+			err = parseJournalExport(file, matches.add)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if matches.count != test.wantCount {
+				t.Errorf("got count %d, want %d", matches.count, test.wantCount)
+			}
+
+			if matches.entries != test.wantEntries {
+				t.Errorf("got entries %d, want %d", matches.entries, test.wantEntries)
+			}
+
+			if !reflect.DeepEqual(matches.samples, test.wantSamples) {
+				t.Errorf("got samples %q, want %q", matches.samples, test.wantSamples)
+			}
+
+			// The cursor points to the last entry regardless of the filters
+			if matches.cursor != "s=1;i=4" {
+				t.Errorf("got cursor %s, want s=1;i=4", matches.cursor)
+			}
+		})
+	}
+}
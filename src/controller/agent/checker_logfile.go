@@ -0,0 +1,343 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+)
+
+const CheckerTypeLogfile = "com.indece.agent.linux.v1.checker.logfile"
+
+// Max. number of bytes at the start of a log file used for detecting
+// truncated files
+const logfileHeadSize = 256
+
+// logfileOffset is the read position in a log file
+//
+// The hash of the start of the file detects files which were truncated and
+// have grown past the offset again (e.g. by logrotate's copytruncate)
+type logfileOffset struct {
+	Inode    uint64 `json:"inode"`
+	Offset   int64  `json:"offset"`
+	HeadSize int64  `json:"head_size"`
+	HeadHash string `json:"head_hash"`
+}
+
+// logfileMatches collects the matching lines of a log file
+type logfileMatches struct {
+	include  *regexp.Regexp
+	exclude  *regexp.Regexp
+	maxLines int
+	count    int64
+	lines    int64
+	last     []string
+}
+
+func (m *logfileMatches) add(line string) {
+	m.lines++
+
+	if m.include != nil && !m.include.MatchString(line) {
+		return
+	}
+
+	if m.exclude != nil && m.exclude.MatchString(line) {
+		return
+	}
+
+	m.count++
+
+	if m.maxLines <= 0 {
+		return
+	}
+
+	m.last = append(m.last, line)
+	if len(m.last) > m.maxLines {
+		m.last = m.last[1:]
+	}
+}
+
+// LogfileChecker counts the lines of a log file matching a pattern since
+// the previous check
+//
+// The read offset is stored in the state of the check, so no lines are
+// missed or counted twice across restarts of the agent
+type LogfileChecker struct {
+}
+
+func (c *LogfileChecker) GetType() string {
+	return CheckerTypeLogfile
+}
+
+func (c *LogfileChecker) GetChecker() (*apiagent.CheckerV1, error) {
+	return &apiagent.CheckerV1{
+		Name:         "Logfile",
+		Type:         CheckerTypeLogfile,
+		Version:      "",
+		CustomChecks: true,
+		Params: []*apiagent.CheckerV1Param{
+			{
+				Name:     "path",
+				Label:    "File path",
+				Type:     apiagent.CheckerV1ParamType_CheckerV1ParamTypeText,
+				Required: true,
+			},
+			{
+				Name:  "include",
+				Label: "Include pattern",
+				Hint:  "Regular expression, all lines are counted if empty",
+				Type:  apiagent.CheckerV1ParamType_CheckerV1ParamTypeText,
+			},
+			{
+				Name:  "exclude",
+				Label: "Exclude pattern",
+				Hint:  "Regular expression",
+				Type:  apiagent.CheckerV1ParamType_CheckerV1ParamTypeText,
+			},
+			{
+				Name:  "max_lines",
+				Label: "Max. lines in message",
+				Type:  apiagent.CheckerV1ParamType_CheckerV1ParamTypeNumber,
+			},
+		},
+		Values: []*apiagent.CheckerV1Value{
+			{
+				Name:    "matches",
+				Type:    apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+				MaxWarn: "1",
+			},
+			{
+				Name: "lines",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+		},
+	}, nil
+}
+
+func (c *LogfileChecker) GetChecks() ([]*apiagent.CheckV1, error) {
+	return []*apiagent.CheckV1{}, nil
+}
+
+func fileInode(fileInfo os.FileInfo) uint64 {
+	stat, ok := fileInfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	return stat.Ino
+}
+
+// findRotatedLogfile searches the directory of a log file for the rotated
+// file with the given inode (e.g. app.log.1), compressed files can't be found
+func findRotatedLogfile(path string, inode uint64) string {
+	filenames, err := filepath.Glob(path + "*")
+	if err != nil {
+		return ""
+	}
+
+	for _, filename := range filenames {
+		if filename == path {
+			continue
+		}
+
+		fileInfo, err := os.Stat(filename)
+		if err == nil && fileInode(fileInfo) == inode {
+			return filename
+		}
+	}
+
+	return ""
+}
+
+// logfileHeadHash returns the hash of the first size bytes of a file
+func logfileHeadHash(filename string, size int64) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+
+	_, err = io.CopyN(hash, file, size)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readLogfile reads all complete lines of a file starting at the offset and
+// returns the offset after the last complete line
+func readLogfile(ctx context.Context, filename string, offset int64, matches *logfileMatches) (int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return offset, err
+	}
+
+	reader := bufio.NewReader(file)
+
+	for ctx.Err() == nil {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// Incomplete lines are read again with the next check
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+
+		offset += int64(len(line))
+
+		matches.add(strings.TrimRight(line, "\r\n"))
+	}
+
+	return offset, ctx.Err()
+}
+
+// headChanged returns true if the start of the file differs from the start
+// read by the previous check
+func (c *LogfileChecker) headChanged(filename string, offset *logfileOffset) bool {
+	headHash, err := logfileHeadHash(filename, offset.HeadSize)
+
+	return err != nil || headHash != offset.HeadHash
+}
+
+func (c *LogfileChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	paramPath := checkParams.String("path", "")
+	paramInclude := checkParams.String("include", "")
+	paramExclude := checkParams.String("exclude", "")
+
+	paramMaxLines, err := checkParams.Int("max_lines", 5)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	matches := &logfileMatches{
+		maxLines: int(paramMaxLines),
+	}
+
+	if paramInclude != "" {
+		matches.include, err = regexp.Compile(paramInclude)
+		if err != nil {
+			return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("invalid value for parameter 'include': %s", err)
+		}
+	}
+
+	if paramExclude != "" {
+		matches.exclude, err = regexp.Compile(paramExclude)
+		if err != nil {
+			return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("invalid value for parameter 'exclude': %s", err)
+		}
+	}
+
+	fileInfo, err := os.Stat(paramPath)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", nil, fmt.Errorf("error checking log file %s: %s", paramPath, err)
+	}
+
+	inode := fileInode(fileInfo)
+
+	state := checkStateFromContext(ctx)
+
+	offset := &logfileOffset{}
+
+	found, err := state.Get("offset", offset)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading offset: %s", err)
+	}
+
+	newOffset := &logfileOffset{
+		Inode:  inode,
+		Offset: 0,
+	}
+
+	switch {
+	case !found:
+		// Start at the end of the file on the first check, so old lines
+		// are not reported
+		newOffset.Offset = fileInfo.Size()
+	case offset.Inode != inode:
+		// The file was rotated, read the rest of the rotated file first
+		rotatedFilename := findRotatedLogfile(paramPath, offset.Inode)
+		if rotatedFilename != "" {
+			_, err = readLogfile(ctx, rotatedFilename, offset.Offset, matches)
+			if err != nil {
+				return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error reading rotated log file %s: %s", rotatedFilename, err)
+			}
+		}
+	case offset.Offset > fileInfo.Size():
+		// The file was truncated, start from the beginning
+	case offset.HeadSize > 0 && c.headChanged(paramPath, offset):
+		// The file was truncated and has grown past the offset again
+	default:
+		newOffset.Offset = offset.Offset
+	}
+
+	newOffset.Offset, err = readLogfile(ctx, paramPath, newOffset.Offset, matches)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error reading log file %s: %s", paramPath, err)
+	}
+
+	newOffset.HeadSize = newOffset.Offset
+	if newOffset.HeadSize > logfileHeadSize {
+		newOffset.HeadSize = logfileHeadSize
+	}
+
+	if newOffset.HeadSize > 0 {
+		newOffset.HeadHash, err = logfileHeadHash(paramPath, newOffset.HeadSize)
+		if err != nil {
+			return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error reading log file %s: %s", paramPath, err)
+		}
+	}
+
+	err = state.Set("offset", newOffset)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error storing offset: %s", err)
+	}
+
+	values := []*apiagent.CheckV1Value{}
+
+	values = append(values, newCheckValueInt("matches", matches.count, ""))
+
+	values = append(values, newCheckValueInt("lines", matches.lines, ""))
+
+	message := fmt.Sprintf(
+		"%d of %d new line(s) in %s matched",
+		matches.count,
+		matches.lines,
+		paramPath,
+	)
+
+	if len(matches.last) > 0 {
+		message = fmt.Sprintf("%s, last:\n%s", message, strings.Join(matches.last, "\n"))
+	}
+
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
+}
+
+var _ IChecker = (*LogfileChecker)(nil)
+
+func NewLogfileChecker() *LogfileChecker {
+	return &LogfileChecker{}
+}
@@ -55,28 +55,24 @@ func (c *MemoryChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	}, nil
 }
 
-func (c *MemoryChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
-	memStats, err := mem.VirtualMemory()
+func (c *MemoryChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	_, err := bindCheckParams(c, params)
 	if err != nil {
-		return "", nil, fmt.Errorf("error loading memory stats: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	memStats, err := mem.VirtualMemoryWithContext(ctx)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading memory stats: %s", err)
 	}
 
 	values := []*apiagent.CheckV1Value{}
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "total",
-		Value: fmt.Sprintf("%d", memStats.Total),
-	})
+	values = append(values, newCheckValueInt("total", int64(memStats.Total), "B"))
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "used",
-		Value: fmt.Sprintf("%d", memStats.Used),
-	})
+	values = append(values, newCheckValueInt("used", int64(memStats.Used), "B"))
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "used_percent",
-		Value: fmt.Sprintf("%.1f", float64(memStats.Used)/math.Max(float64(memStats.Total), 1)*100.0),
-	})
+	values = append(values, newCheckValueDouble("used_percent", float64(memStats.Used)/math.Max(float64(memStats.Total), 1)*100.0, 1, "%"))
 
 	message := fmt.Sprintf(
 		"%.1f%% (%s of %s) used of memory",
@@ -85,7 +81,7 @@ func (c *MemoryChecker) Check(ctx context.Context, params []*apiagent.CheckV1Par
 		utils.FormatBytes(int64(memStats.Total)),
 	)
 
-	return message, values, nil
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
 }
 
 var _ IChecker = (*MemoryChecker)(nil)
@@ -0,0 +1,344 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/indece-official/monitor-agent-linux/src/utils"
+)
+
+const CheckerTypeNagios = "com.indece.agent.linux.v1.checker.nagios"
+
+// Exit codes of nagios / monitoring-plugins
+const (
+	nagiosExitCodeOK       = 0
+	nagiosExitCodeWarning  = 1
+	nagiosExitCodeCritical = 2
+	nagiosExitCodeUnknown  = 3
+)
+
+// nagiosPerfData is a single entry of the performance data of a plugin
+// in the format 'label'=value[UOM];[warn];[crit];[min];[max]
+type nagiosPerfData struct {
+	Label string
+	Value string
+	UOM   string
+	Warn  string
+	Crit  string
+	Min   string
+	Max   string
+}
+
+// splitNagiosPerfData splits performance data at spaces outside of
+// single-quoted labels
+func splitNagiosPerfData(str string) []string {
+	parts := []string{}
+	part := strings.Builder{}
+	quoted := false
+
+	for _, r := range str {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			part.WriteRune(r)
+		case (r == ' ' || r == '\t') && !quoted:
+			if part.Len() > 0 {
+				parts = append(parts, part.String())
+				part.Reset()
+			}
+		default:
+			part.WriteRune(r)
+		}
+	}
+
+	if part.Len() > 0 {
+		parts = append(parts, part.String())
+	}
+
+	return parts
+}
+
+func parseNagiosPerfData(str string) ([]*nagiosPerfData, error) {
+	perfDatas := []*nagiosPerfData{}
+
+	for _, part := range splitNagiosPerfData(str) {
+		index := strings.LastIndex(part, "=")
+		if index <= 0 {
+			return nil, fmt.Errorf("invalid performance data '%s'", part)
+		}
+
+		label := part[:index]
+		if len(label) >= 2 && strings.HasPrefix(label, "'") && strings.HasSuffix(label, "'") {
+			label = strings.ReplaceAll(label[1:len(label)-1], "''", "'")
+		}
+
+		fields := strings.Split(part[index+1:], ";")
+		for len(fields) < 5 {
+			fields = append(fields, "")
+		}
+
+		value := fields[0]
+		uom := ""
+		// "U" marks a value which could not be determined, not a unit
+		if value != "U" {
+			uom = strings.TrimLeft(value, "-+.0123456789eE")
+			value = strings.TrimSuffix(value, uom)
+		}
+
+		perfDatas = append(perfDatas, &nagiosPerfData{
+			Label: label,
+			Value: value,
+			UOM:   uom,
+			Warn:  fields[1],
+			Crit:  fields[2],
+			Min:   fields[3],
+			Max:   fields[4],
+		})
+	}
+
+	return perfDatas, nil
+}
+
+// parseNagiosOutput parses the output of a plugin in the format
+// "text | perfdata\nlong text | perfdata\nperfdata"
+func parseNagiosOutput(output string) (string, []*nagiosPerfData, error) {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+
+	texts := []string{}
+	perfDataStrs := []string{}
+
+	firstLineParts := strings.SplitN(lines[0], "|", 2)
+	texts = append(texts, strings.TrimSpace(firstLineParts[0]))
+	if len(firstLineParts) == 2 {
+		perfDataStrs = append(perfDataStrs, firstLineParts[1])
+	}
+
+	inPerfData := false
+
+	for _, line := range lines[1:] {
+		if inPerfData {
+			perfDataStrs = append(perfDataStrs, line)
+
+			continue
+		}
+
+		lineParts := strings.SplitN(line, "|", 2)
+		texts = append(texts, lineParts[0])
+		if len(lineParts) == 2 {
+			// All following lines contain performance data
+			perfDataStrs = append(perfDataStrs, lineParts[1])
+			inPerfData = true
+		}
+	}
+
+	perfDatas, err := parseNagiosPerfData(strings.Join(perfDataStrs, " "))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return strings.TrimSpace(strings.Join(texts, "\n")), perfDatas, nil
+}
+
+// newNagiosCheckValue creates a numeric value if possible, falling back to text
+// (e.g. for ranges like "10:20" or unknown values "U")
+func newNagiosCheckValue(name string, value string, uom string) *apiagent.CheckV1Value {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return newCheckValueText(name, value)
+	}
+
+	checkValue := newCheckValueDouble(name, number, 0, uom)
+	// Keep the original formatting
+	checkValue.Value = value
+
+	return checkValue
+}
+
+// NagiosChecker runs nagios / monitoring-plugins compatible commands
+//
+// Only commands from the allow-list in the local config can be run
+type NagiosChecker struct {
+	mutex    sync.Mutex
+	commands map[string][]string
+}
+
+// SetCommands sets the allowed commands, mapping their name to the command line
+func (c *NagiosChecker) SetCommands(commands map[string][]string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.commands = commands
+}
+
+func (c *NagiosChecker) getCommand(name string) ([]string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	command, ok := c.commands[name]
+
+	return command, ok
+}
+
+func (c *NagiosChecker) GetType() string {
+	return CheckerTypeNagios
+}
+
+func (c *NagiosChecker) GetChecker() (*apiagent.CheckerV1, error) {
+	c.mutex.Lock()
+	commandNames := []string{}
+	for name := range c.commands {
+		commandNames = append(commandNames, name)
+	}
+	c.mutex.Unlock()
+
+	sort.Strings(commandNames)
+
+	return &apiagent.CheckerV1{
+		Name:         "Nagios plugin",
+		Type:         CheckerTypeNagios,
+		Version:      "",
+		CustomChecks: true,
+		Params: []*apiagent.CheckerV1Param{
+			{
+				Name:     "command",
+				Label:    "Command",
+				Hint:     "Commands are configured in the local config of the agent",
+				Type:     apiagent.CheckerV1ParamType_CheckerV1ParamTypeSelect,
+				Options:  commandNames,
+				Required: true,
+			},
+		},
+		Values: []*apiagent.CheckerV1Value{
+			{
+				Name: "exit_code",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+		},
+	}, nil
+}
+
+func (c *NagiosChecker) GetChecks() ([]*apiagent.CheckV1, error) {
+	return []*apiagent.CheckV1{}, nil
+}
+
+// nagiosCheckValues creates the values for the exit code and performance
+// data of a plugin
+//
+// Names already used (e.g. the label "exit_code" or "load_warn" besides the
+// warning limit of "load") get a numeric suffix, so all values are unique
+func nagiosCheckValues(exitCode int, perfDatas []*nagiosPerfData) []*apiagent.CheckV1Value {
+	values := []*apiagent.CheckV1Value{}
+	names := map[string]bool{}
+
+	addValue := func(value *apiagent.CheckV1Value) {
+		name := value.Name
+		for i := 2; names[value.Name]; i++ {
+			value.Name = fmt.Sprintf("%s_%d", name, i)
+		}
+
+		names[value.Name] = true
+
+		values = append(values, value)
+	}
+
+	addValue(newCheckValueInt("exit_code", int64(exitCode), ""))
+
+	for _, perfData := range perfDatas {
+		addValue(newNagiosCheckValue(perfData.Label, perfData.Value, perfData.UOM))
+
+		limits := [][2]string{
+			{"warn", perfData.Warn},
+			{"crit", perfData.Crit},
+			{"min", perfData.Min},
+			{"max", perfData.Max},
+		}
+
+		for _, limit := range limits {
+			if limit[1] == "" {
+				continue
+			}
+
+			addValue(newNagiosCheckValue(
+				fmt.Sprintf("%s_%s", perfData.Label, limit[0]),
+				limit[1],
+				perfData.UOM,
+			))
+		}
+	}
+
+	return values
+}
+
+func (c *NagiosChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	paramCommand := checkParams.String("command", "")
+
+	command, ok := c.getCommand(paramCommand)
+	if !ok {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("command '%s' is not allowed", paramCommand)
+	}
+
+	cmd := utils.CommandContext(ctx, command[0], command[1:]...)
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	exitCode := nagiosExitCodeOK
+
+	err = cmd.Run()
+	if err != nil {
+		exitErr := &exec.ExitError{}
+		if !errors.As(err, &exitErr) || ctx.Err() != nil {
+			return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error running command '%s': %s (%s)", paramCommand, err, stderr.String())
+		}
+
+		exitCode = exitErr.ExitCode()
+	}
+
+	output := stdout.String()
+	if strings.TrimSpace(output) == "" {
+		output = stderr.String()
+	}
+
+	message, perfDatas, err := parseNagiosOutput(output)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error parsing output of command '%s': %s", paramCommand, err)
+	}
+
+	values := nagiosCheckValues(exitCode, perfDatas)
+
+	switch exitCode {
+	case nagiosExitCodeOK:
+		return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
+	case nagiosExitCodeWarning:
+		return apiagent.CheckV1Status_CheckV1StatusWarning, message, values, nil
+	case nagiosExitCodeCritical:
+		return apiagent.CheckV1Status_CheckV1StatusCritical, message, values, nil
+	case nagiosExitCodeUnknown:
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, message, values, nil
+	default:
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, fmt.Sprintf("Invalid exit code %d: %s", exitCode, message), values, nil
+	}
+}
+
+var _ IChecker = (*NagiosChecker)(nil)
+
+func NewNagiosChecker() *NagiosChecker {
+	return &NagiosChecker{
+		commands: map[string][]string{},
+	}
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNagiosOutput(t *testing.T) {
+	tests := []struct {
+		name          string
+		output        string
+		wantMessage   string
+		wantPerfDatas []*nagiosPerfData
+		wantErr       bool
+	}{
+		{
+			name:          "text only",
+			output:        "OK - all fine\n",
+			wantMessage:   "OK - all fine",
+			wantPerfDatas: []*nagiosPerfData{},
+		},
+		{
+			name:        "perfdata",
+			output:      "LOAD OK | load1=0.5;1;2;0; load5=0.25\n",
+			wantMessage: "LOAD OK",
+			wantPerfDatas: []*nagiosPerfData{
+				{Label: "load1", Value: "0.5", Warn: "1", Crit: "2", Min: "0"},
+				{Label: "load5", Value: "0.25"},
+			},
+		},
+		{
+			name:        "quoted label with unit",
+			output:      "DISK OK | '/var/lib/it''s used'=85%;80:90;95\n",
+			wantMessage: "DISK OK",
+			wantPerfDatas: []*nagiosPerfData{
+				{Label: "/var/lib/it's used", Value: "85", UOM: "%", Warn: "80:90", Crit: "95"},
+			},
+		},
+		{
+			name:        "long text with perfdata lines",
+			output:      "PROCS OK | procs=10\nfirst\nsecond | zombies=0\nthreads=20c\n",
+			wantMessage: "PROCS OK\nfirst\nsecond",
+			wantPerfDatas: []*nagiosPerfData{
+				{Label: "procs", Value: "10"},
+				{Label: "zombies", Value: "0"},
+				{Label: "threads", Value: "20", UOM: "c"},
+			},
+		},
+		{
+			name:        "unknown value",
+			output:      "PING UNKNOWN | rta=U;100;500;0\n",
+			wantMessage: "PING UNKNOWN",
+			wantPerfDatas: []*nagiosPerfData{
+				{Label: "rta", Value: "U", Warn: "100", Crit: "500", Min: "0"},
+			},
+		},
+		{
+			name:    "invalid perfdata",
+			output:  "OK | invalid\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message, perfDatas, err := parseNagiosOutput(test.output)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if test.wantErr {
+				return
+			}
+
+			if message != test.wantMessage {
+				t.Errorf("got message %q, want %q", message, test.wantMessage)
+			}
+
+			if !reflect.DeepEqual(perfDatas, test.wantPerfDatas) {
+				t.Errorf("got perfdata %+v, want %+v", perfDatas, test.wantPerfDatas)
+			}
+		})
+	}
+}
+
+func TestNagiosCheckValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		perfDatas []*nagiosPerfData
+		wantNames []string
+	}{
+		{
+			name: "limits",
+			perfDatas: []*nagiosPerfData{
+				{Label: "load", Value: "1", Warn: "2", Crit: "3"},
+			},
+			wantNames: []string{"exit_code", "load", "load_warn", "load_crit"},
+		},
+		{
+			name: "label exit_code",
+			perfDatas: []*nagiosPerfData{
+				{Label: "exit_code", Value: "1"},
+			},
+			wantNames: []string{"exit_code", "exit_code_2"},
+		},
+		{
+			name: "label colliding with limit",
+			perfDatas: []*nagiosPerfData{
+				{Label: "load", Value: "1", Warn: "2"},
+				{Label: "load_warn", Value: "4"},
+				{Label: "load", Value: "5"},
+			},
+			wantNames: []string{"exit_code", "load", "load_warn", "load_warn_2", "load_2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			names := []string{}
+			for _, value := range nagiosCheckValues(0, test.perfDatas) {
+				names = append(names, value.Name)
+			}
+
+			if !reflect.DeepEqual(names, test.wantNames) {
+				t.Errorf("got names %v, want %v", names, test.wantNames)
+			}
+		})
+	}
+}
+
+func TestNewNagiosCheckValueUnknown(t *testing.T) {
+	value := newNagiosCheckValue("rta", "U", "")
+
+	if value.Value != "U" || value.Unit != "" || value.TypedValue != nil {
+		t.Errorf("got value %+v, want text value U", value)
+	}
+}
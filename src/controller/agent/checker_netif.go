@@ -0,0 +1,326 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/indece-official/monitor-agent-linux/src/utils"
+)
+
+const CheckerTypeNetif = "com.indece.agent.linux.v1.checker.netif"
+
+const (
+	netifProcFilename = "/proc/net/dev"
+	netifSysDir       = "/sys/class/net"
+)
+
+// netifCounters contains the counters of an interface from /proc/net/dev
+type netifCounters struct {
+	RxBytes   uint64
+	RxErrors  uint64
+	RxDropped uint64
+	TxBytes   uint64
+	TxErrors  uint64
+	TxDropped uint64
+}
+
+// parseNetDev parses the counters per interface in the format of
+// /proc/net/dev
+func parseNetDev(r io.Reader) (map[string]*netifCounters, error) {
+	counters := map[string]*netifCounters{}
+
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		name, data, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			// Header lines
+			continue
+		}
+
+		fields := strings.Fields(data)
+		if len(fields) < 16 {
+			return nil, fmt.Errorf("invalid line for interface %s", strings.TrimSpace(name))
+		}
+
+		numbers := make([]uint64, len(fields))
+		for i, field := range fields {
+			number, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid counter for interface %s: %s", strings.TrimSpace(name), err)
+			}
+
+			numbers[i] = number
+		}
+
+		counters[strings.TrimSpace(name)] = &netifCounters{
+			RxBytes:   numbers[0],
+			RxErrors:  numbers[2],
+			RxDropped: numbers[3],
+			TxBytes:   numbers[8],
+			TxErrors:  numbers[10],
+			TxDropped: numbers[11],
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+// readNetifAttr reads an attribute of an interface from sysfs
+func readNetifAttr(name string, attr string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(netifSysDir, name, attr))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// NetifChecker checks the link state and throughput of a network interface
+//
+// The rates are calculated from the counters stored in the state of the
+// check by its previous run
+type NetifChecker struct {
+}
+
+func (c *NetifChecker) GetType() string {
+	return CheckerTypeNetif
+}
+
+func (c *NetifChecker) GetChecker() (*apiagent.CheckerV1, error) {
+	return &apiagent.CheckerV1{
+		Name:         "Network interface",
+		Type:         CheckerTypeNetif,
+		Version:      "",
+		CustomChecks: true,
+		Params: []*apiagent.CheckerV1Param{
+			{
+				Name:     "interface",
+				Label:    "Interface",
+				Type:     apiagent.CheckerV1ParamType_CheckerV1ParamTypeText,
+				Required: true,
+			},
+		},
+		Values: []*apiagent.CheckerV1Value{
+			{
+				Name: "operstate",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeText,
+			},
+			{
+				Name: "carrier",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+			{
+				Name: "speed",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+			{
+				Name: "mtu",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+			{
+				Name: "rx_rate",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+			{
+				Name: "tx_rate",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+			{
+				Name:    "rx_errors",
+				Type:    apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+				MaxWarn: "1",
+			},
+			{
+				Name:    "tx_errors",
+				Type:    apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+				MaxWarn: "1",
+			},
+			{
+				Name: "rx_dropped",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+			{
+				Name: "tx_dropped",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+		},
+	}, nil
+}
+
+func (c *NetifChecker) GetChecks() ([]*apiagent.CheckV1, error) {
+	checks := []*apiagent.CheckV1{}
+
+	entries, err := os.ReadDir(netifSysDir)
+	if err != nil {
+		return nil, fmt.Errorf("error loading interface list: %s", err)
+	}
+
+	names := []string{}
+
+	for _, entry := range entries {
+		_, err := os.Stat(filepath.Join(netifSysDir, entry.Name(), "device"))
+		if err != nil {
+			// Ignore virtual interfaces (e.g. lo, bridges, veth)
+			continue
+		}
+
+		names = append(names, entry.Name())
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		checks = append(checks, &apiagent.CheckV1{
+			Name:        fmt.Sprintf("Network interface %s", name),
+			Type:        fmt.Sprintf("%s:%s", CheckerTypeNetif, name),
+			CheckerType: CheckerTypeNetif,
+			Params: []*apiagent.CheckV1Param{
+				{
+					Name:  "interface",
+					Value: name,
+				},
+			},
+		})
+	}
+
+	return checks, nil
+}
+
+func (c *NetifChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	paramInterface := checkParams.String("interface", "")
+
+	file, err := os.Open(netifProcFilename)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error reading interface stats: %s", err)
+	}
+	defer file.Close()
+
+	mapCounters, err := parseNetDev(file)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error parsing interface stats: %s", err)
+	}
+
+	counters, ok := mapCounters[paramInterface]
+	if !ok {
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", nil, fmt.Errorf("interface %s not found", paramInterface)
+	}
+
+	now := time.Now()
+
+	operstate, err := readNetifAttr(paramInterface, "operstate")
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading state of interface %s: %s", paramInterface, err)
+	}
+
+	values := []*apiagent.CheckV1Value{}
+
+	values = append(values, newCheckValueText("operstate", operstate))
+
+	// carrier can't be read while the interface is down
+	carrier := false
+	strCarrier, err := readNetifAttr(paramInterface, "carrier")
+	if err == nil {
+		carrier = strCarrier == "1"
+
+		values = append(values, newCheckValueBool("carrier", carrier))
+	}
+
+	// speed is -1 or can't be read for interfaces without a link
+	speed, err := readNetifAttr(paramInterface, "speed")
+	if err == nil {
+		intSpeed, err := strconv.ParseInt(speed, 10, 64)
+		if err == nil && intSpeed > 0 {
+			values = append(values, newCheckValueInt("speed", intSpeed, "Mbit/s"))
+		}
+	}
+
+	mtu, err := readNetifAttr(paramInterface, "mtu")
+	if err == nil {
+		intMTU, err := strconv.ParseInt(mtu, 10, 64)
+		if err == nil {
+			values = append(values, newCheckValueInt("mtu", intMTU, "B"))
+		}
+	}
+
+	message := fmt.Sprintf("Interface %s is %s", paramInterface, operstate)
+
+	// Rates and deltas are missing on the first check and after counters
+	// were reset (e.g. when a driver is reloaded)
+	state := checkStateFromContext(ctx)
+
+	rxRate, rxRateOK := state.Rate("rx_bytes", counters.RxBytes, now)
+
+	txRate, txRateOK := state.Rate("tx_bytes", counters.TxBytes, now)
+
+	if rxRateOK {
+		values = append(values, newCheckValueDouble("rx_rate", rxRate, 0, "B/s"))
+	}
+
+	if txRateOK {
+		values = append(values, newCheckValueDouble("tx_rate", txRate, 0, "B/s"))
+	}
+
+	deltaCounters := []struct {
+		name  string
+		value uint64
+	}{
+		{"rx_errors", counters.RxErrors},
+		{"tx_errors", counters.TxErrors},
+		{"rx_dropped", counters.RxDropped},
+		{"tx_dropped", counters.TxDropped},
+	}
+
+	for _, deltaCounter := range deltaCounters {
+		delta, _, ok := state.Delta(deltaCounter.name, deltaCounter.value, now)
+		if ok {
+			values = append(values, newCheckValueInt(deltaCounter.name, int64(delta), ""))
+		}
+	}
+
+	if rxRateOK && txRateOK {
+		message = fmt.Sprintf(
+			"%s, rx %s/s, tx %s/s",
+			message,
+			utils.FormatBytes(int64(rxRate)),
+			utils.FormatBytes(int64(txRate)),
+		)
+	}
+
+	switch operstate {
+	case "up", "unknown":
+		// Interfaces without operstate support (e.g. tun) report unknown
+		if strCarrier == "0" {
+			return apiagent.CheckV1Status_CheckV1StatusCritical, message + ", no carrier", values, nil
+		}
+
+		return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
+	default:
+		return apiagent.CheckV1Status_CheckV1StatusCritical, message, values, nil
+	}
+}
+
+var _ IChecker = (*NetifChecker)(nil)
+
+func NewNetifChecker() *NetifChecker {
+	return &NetifChecker{}
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNetDev(t *testing.T) {
+	header := "Inter-|   Receive                                                |  Transmit\n" +
+		" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n"
+
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]*netifCounters
+		wantErr bool
+	}{
+		{
+			name:  "header only",
+			input: header,
+			want:  map[string]*netifCounters{},
+		},
+		{
+			name: "interfaces",
+			input: header +
+				"    lo: 1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0\n" +
+				"  eth0:123456789 98765 1 2 0 0 0 15 987654321 12345 3 4 0 0 0 0\n",
+			want: map[string]*netifCounters{
+				"lo": {
+					RxBytes: 1000,
+					TxBytes: 1000,
+				},
+				"eth0": {
+					RxBytes:   123456789,
+					RxErrors:  1,
+					RxDropped: 2,
+					TxBytes:   987654321,
+					TxErrors:  3,
+					TxDropped: 4,
+				},
+			},
+		},
+		{
+			name:    "missing counters",
+			input:   header + "  eth0: 1 2 3\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid counter",
+			input:   header + "  eth0: 1 2 3 4 5 6 7 8 9 10 11 x 13 14 15 16\n",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counters, err := parseNetDev(strings.NewReader(test.input))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if !test.wantErr && !reflect.DeepEqual(counters, test.want) {
+				t.Errorf("got %+v, want %+v", counters, test.want)
+			}
+		})
+	}
+}
@@ -53,28 +53,24 @@ func (c *OSChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	}, nil
 }
 
-func (c *OSChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
-	hostInfo, err := host.Info()
+func (c *OSChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	_, err := bindCheckParams(c, params)
 	if err != nil {
-		return "", nil, fmt.Errorf("error loading host info: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	hostInfo, err := host.InfoWithContext(ctx)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading host info: %s", err)
 	}
 
 	values := []*apiagent.CheckV1Value{}
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "os",
-		Value: hostInfo.OS,
-	})
+	values = append(values, newCheckValueText("os", hostInfo.OS))
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "platform",
-		Value: hostInfo.Platform,
-	})
+	values = append(values, newCheckValueText("platform", hostInfo.Platform))
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "platform_version",
-		Value: hostInfo.PlatformVersion,
-	})
+	values = append(values, newCheckValueText("platform_version", hostInfo.PlatformVersion))
 
 	message := fmt.Sprintf(
 		"Running %s %s (kernel %s)",
@@ -83,7 +79,7 @@ func (c *OSChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param)
 		hostInfo.KernelVersion,
 	)
 
-	return message, values, nil
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
 }
 
 var _ IChecker = (*OSChecker)(nil)
@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+)
+
+// checkParams contains the params of a check validated against the params
+// of its checker
+//
+// The getters return the default value for params which are not set,
+// empty values are treated as not set
+type checkParams struct {
+	values map[string]string
+}
+
+// validateCheckParam validates a value against the type of a checker param
+func validateCheckParam(checkerParam *apiagent.CheckerV1Param, value string) error {
+	var err error
+
+	switch checkerParam.Type {
+	case apiagent.CheckerV1ParamType_CheckerV1ParamTypeNumber:
+		_, err = strconv.ParseFloat(value, 64)
+	case apiagent.CheckerV1ParamType_CheckerV1ParamTypeDuration:
+		_, err = time.ParseDuration(value)
+	case apiagent.CheckerV1ParamType_CheckerV1ParamTypeBoolean:
+		_, err = strconv.ParseBool(value)
+	case apiagent.CheckerV1ParamType_CheckerV1ParamTypeSelect:
+		err = fmt.Errorf("must be one of %s", strings.Join(checkerParam.Options, ", "))
+		for _, option := range checkerParam.Options {
+			if option == value {
+				err = nil
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for parameter '%s': %s", checkerParam.Name, err)
+	}
+
+	return nil
+}
+
+// parseCheckParams validates params against the params of a checker,
+// rejecting missing required params and invalid values
+//
+// Unknown params are ignored, see unknownCheckParams
+func parseCheckParams(reqChecker *apiagent.CheckerV1, params []*apiagent.CheckV1Param) (*checkParams, error) {
+	p := &checkParams{
+		values: map[string]string{},
+	}
+
+	mapCheckerParams := map[string]*apiagent.CheckerV1Param{}
+	for _, checkerParam := range reqChecker.Params {
+		mapCheckerParams[checkerParam.Name] = checkerParam
+	}
+
+	for _, param := range params {
+		checkerParam, ok := mapCheckerParams[param.Name]
+		if !ok {
+			continue
+		}
+
+		if param.Value == "" {
+			continue
+		}
+
+		err := validateCheckParam(checkerParam, param.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		p.values[param.Name] = param.Value
+	}
+
+	for _, checkerParam := range reqChecker.Params {
+		if checkerParam.Required && p.values[checkerParam.Name] == "" {
+			return nil, fmt.Errorf("missing parameter '%s'", checkerParam.Name)
+		}
+	}
+
+	return p, nil
+}
+
+// unknownCheckParams returns the names of params which are not params of a
+// checker
+func unknownCheckParams(reqChecker *apiagent.CheckerV1, params []*apiagent.CheckV1Param) []string {
+	mapCheckerParams := map[string]bool{}
+	for _, checkerParam := range reqChecker.Params {
+		mapCheckerParams[checkerParam.Name] = true
+	}
+
+	names := []string{}
+	for _, param := range params {
+		if !mapCheckerParams[param.Name] {
+			names = append(names, param.Name)
+		}
+	}
+
+	return names
+}
+
+// bindCheckParams validates params against the params of the checker
+func bindCheckParams(checker IChecker, params []*apiagent.CheckV1Param) (*checkParams, error) {
+	reqChecker, err := checker.GetChecker()
+	if err != nil {
+		return nil, fmt.Errorf("error loading checker: %s", err)
+	}
+
+	return parseCheckParams(reqChecker, params)
+}
+
+// Has returns true if a param is set
+func (p *checkParams) Has(name string) bool {
+	_, ok := p.values[name]
+
+	return ok
+}
+
+func (p *checkParams) String(name string, defaultValue string) string {
+	value, ok := p.values[name]
+	if !ok {
+		return defaultValue
+	}
+
+	return value
+}
+
+func (p *checkParams) Float(name string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(p.values[name], 64)
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
+
+// Int returns an error for values which are not integers
+func (p *checkParams) Int(name string, defaultValue int64) (int64, error) {
+	value, ok := p.values[name]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	intValue, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for parameter '%s': must be an integer", name)
+	}
+
+	return intValue, nil
+}
+
+func (p *checkParams) Bool(name string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(p.values[name])
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
+
+func (p *checkParams) Duration(name string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(p.values[name])
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+)
+
+func TestParseCheckParams(t *testing.T) {
+	reqChecker := &apiagent.CheckerV1{
+		Params: []*apiagent.CheckerV1Param{
+			{
+				Name:     "path",
+				Type:     apiagent.CheckerV1ParamType_CheckerV1ParamTypeText,
+				Required: true,
+			},
+			{
+				Name: "count",
+				Type: apiagent.CheckerV1ParamType_CheckerV1ParamTypeNumber,
+			},
+			{
+				Name: "timeout",
+				Type: apiagent.CheckerV1ParamType_CheckerV1ParamTypeDuration,
+			},
+			{
+				Name: "follow",
+				Type: apiagent.CheckerV1ParamType_CheckerV1ParamTypeBoolean,
+			},
+			{
+				Name:    "mode",
+				Type:    apiagent.CheckerV1ParamType_CheckerV1ParamTypeSelect,
+				Options: []string{"fast", "slow"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "required only",
+			params: map[string]string{"path": "/tmp"},
+			want:   map[string]string{"path": "/tmp"},
+		},
+		{
+			name: "all types",
+			params: map[string]string{
+				"path":    "/tmp",
+				"count":   "1.5",
+				"timeout": "10s",
+				"follow":  "true",
+				"mode":    "slow",
+			},
+			want: map[string]string{
+				"path":    "/tmp",
+				"count":   "1.5",
+				"timeout": "10s",
+				"follow":  "true",
+				"mode":    "slow",
+			},
+		},
+		{
+			name:   "empty values are not set",
+			params: map[string]string{"path": "/tmp", "count": ""},
+			want:   map[string]string{"path": "/tmp"},
+		},
+		{
+			name:    "missing required",
+			params:  map[string]string{"count": "1"},
+			wantErr: true,
+		},
+		{
+			name:    "empty required",
+			params:  map[string]string{"path": ""},
+			wantErr: true,
+		},
+		{
+			name:   "unknown param",
+			params: map[string]string{"path": "/tmp", "other": "1"},
+			want:   map[string]string{"path": "/tmp"},
+		},
+		{
+			name:    "invalid number",
+			params:  map[string]string{"path": "/tmp", "count": "abc"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid duration",
+			params:  map[string]string{"path": "/tmp", "timeout": "10"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid boolean",
+			params:  map[string]string{"path": "/tmp", "follow": "maybe"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid option",
+			params:  map[string]string{"path": "/tmp", "mode": "medium"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params := []*apiagent.CheckV1Param{}
+			for name, value := range test.params {
+				params = append(params, &apiagent.CheckV1Param{
+					Name:  name,
+					Value: value,
+				})
+			}
+
+			checkParams, err := parseCheckParams(reqChecker, params)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("got error %v, want error %v", err, test.wantErr)
+			}
+
+			if !test.wantErr && !reflect.DeepEqual(checkParams.values, test.want) {
+				t.Errorf("got %v, want %v", checkParams.values, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckParamsGetters(t *testing.T) {
+	checkParams := &checkParams{
+		values: map[string]string{
+			"count":   "2.5",
+			"lines":   "3",
+			"timeout": "invalid",
+		},
+	}
+
+	if value := checkParams.Float("count", 1); value != 2.5 {
+		t.Errorf("got count %f, want 2.5", value)
+	}
+
+	if _, err := checkParams.Int("count", 1); err == nil {
+		t.Errorf("got no error for non-integer count")
+	}
+
+	if value, err := checkParams.Int("missing", 7); err != nil || value != 7 {
+		t.Errorf("got default %d (%v), want 7", value, err)
+	}
+
+	if value, err := checkParams.Int("lines", 1); err != nil || value != 3 {
+		t.Errorf("got lines %d (%v), want 3", value, err)
+	}
+
+	if value := checkParams.Duration("timeout", 5); value != 5 {
+		t.Errorf("got invalid duration %s, want default", value)
+	}
+
+	if checkParams.Has("missing") || !checkParams.Has("count") {
+		t.Errorf("got wrong result of Has")
+	}
+}
+
+func TestUnknownCheckParams(t *testing.T) {
+	reqChecker := &apiagent.CheckerV1{
+		Params: []*apiagent.CheckerV1Param{
+			{Name: "path"},
+		},
+	}
+
+	names := unknownCheckParams(reqChecker, []*apiagent.CheckV1Param{
+		{Name: "path", Value: "/tmp"},
+		{Name: "other", Value: "1"},
+	})
+	if !reflect.DeepEqual(names, []string{"other"}) {
+		t.Errorf("got unknown params %v, want [other]", names)
+	}
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
 	probing "github.com/prometheus-community/pro-bing"
-	"gopkg.in/guregu/null.v4"
 )
 
 const CheckerTypePing = "com.indece.agent.linux.v1.checker.ping"
@@ -51,61 +50,39 @@ func (c *PingChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	return []*apiagent.CheckV1{}, nil
 }
 
-func (c *PingChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
-	var err error
-
-	paramHost := null.String{}
-	paramTimeout := 3 * time.Second
-
-	for _, param := range params {
-		if param.Value == "" {
-			continue
-		}
-
-		switch param.Name {
-		case "host":
-			paramHost.Scan(param.Value)
-		case "timeout":
-			paramTimeout, err = time.ParseDuration(param.Value)
-			if err != nil {
-				return "", nil, fmt.Errorf("error parsing parameter 'timeout': %s", err)
-			}
-		default:
-			return "", nil, fmt.Errorf("unknown parameter '%s'", param.Name)
-		}
+func (c *PingChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
 	}
 
-	if !paramHost.Valid || paramHost.String == "" {
-		return "", nil, fmt.Errorf("missing parameter 'host'")
-	}
+	paramHost := checkParams.String("host", "")
+	paramTimeout := checkParams.Duration("timeout", 3*time.Second)
 
-	pinger, err := probing.NewPinger(paramHost.String)
+	pinger, err := probing.NewPinger(paramHost)
 	if err != nil {
-		return "", nil, fmt.Errorf("error initializing ping: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error initializing ping: %s", err)
 	}
 	pinger.Count = 1
 	pinger.Timeout = paramTimeout
-	err = pinger.Run()
+	err = pinger.RunWithContext(ctx)
 	if err != nil {
-		return "", nil, fmt.Errorf("error pinging %s: %s", paramHost.String, err)
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", nil, fmt.Errorf("error pinging %s: %s", paramHost, err)
 	}
 
 	stats := pinger.Statistics()
 
 	values := []*apiagent.CheckV1Value{}
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "time",
-		Value: stats.AvgRtt.String(),
-	})
+	values = append(values, newCheckValueDuration("time", stats.AvgRtt))
 
 	message := fmt.Sprintf(
 		"Ping %s (%dms)",
-		paramHost.String,
+		paramHost,
 		stats.AvgRtt/time.Millisecond,
 	)
 
-	return message, values, nil
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
 }
 
 var _ IChecker = (*PingChecker)(nil)
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/indece-official/go-gousu/v2/gousu/logger"
+	"github.com/indece-official/monitor-agent-linux/src/buildvars"
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/indece-official/monitor-agent-linux/src/utils"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Commands of the plugin protocol (see assets/grpc/plugin.proto)
+const (
+	pluginCommandGetChecker = "get-checker"
+	pluginCommandGetChecks  = "get-checks"
+	pluginCommandCheck      = "check"
+)
+
+// PluginChecker wraps a checker plugin, an executable exchanging json
+// messages with the agent over stdin / stdout
+type PluginChecker struct {
+	log      *logger.Log
+	filename string
+	timeout  time.Duration
+	checker  *apiagent.CheckerV1
+}
+
+func (c *PluginChecker) name() string {
+	return filepath.Base(c.filename)
+}
+
+// run runs a command of the plugin, writing the request to stdin and
+// reading the response from stdout
+func (c *PluginChecker) run(ctx context.Context, command string, req proto.Message, resp proto.Message) error {
+	reqJSON, err := protojson.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %s", err)
+	}
+
+	cmd := utils.CommandContext(ctx, c.filename, command)
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+
+	cmd.Stdin = bytes.NewReader(reqJSON)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("error running plugin %s %s: %s (%s)", c.name(), command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(stdout.Bytes(), resp)
+	if err != nil {
+		return fmt.Errorf("error decoding response of plugin %s %s: %s", c.name(), command, err)
+	}
+
+	return nil
+}
+
+func (c *PluginChecker) GetType() string {
+	return c.checker.Type
+}
+
+func (c *PluginChecker) GetChecker() (*apiagent.CheckerV1, error) {
+	return c.checker, nil
+}
+
+// GetChecks returns the autodiscovered checks of the plugin, a failing
+// plugin is logged and has no checks
+func (c *PluginChecker) GetChecks() ([]*apiagent.CheckV1, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	resp := &apiagent.PluginV1GetChecksResponse{}
+
+	err := c.run(ctx, pluginCommandGetChecks, &apiagent.PluginV1GetChecksRequest{}, resp)
+	if err != nil {
+		c.log.Warnf("Error loading checks of plugin %s: %s", c.name(), err)
+
+		return []*apiagent.CheckV1{}, nil
+	}
+
+	for _, check := range resp.Checks {
+		if check.CheckerType == "" {
+			check.CheckerType = c.checker.Type
+		}
+
+		if check.CheckerType != c.checker.Type {
+			c.log.Warnf("Plugin %s returned check '%s' of other checker type %s", c.name(), check.Type, check.CheckerType)
+
+			return []*apiagent.CheckV1{}, nil
+		}
+	}
+
+	return resp.Checks, nil
+}
+
+func (c *PluginChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	// Params are validated against the params declared by the plugin
+	_, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	resp := &apiagent.PluginV1CheckResponse{}
+
+	err = c.run(ctx, pluginCommandCheck, &apiagent.PluginV1CheckRequest{Params: params}, resp)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	if resp.Error != "" {
+		return resp.Status, resp.Message, resp.Values, errors.New(resp.Error)
+	}
+
+	return resp.Status, resp.Message, resp.Values, nil
+}
+
+var _ IChecker = (*PluginChecker)(nil)
+
+// NewPluginChecker loads the checker definition of a plugin, timeout
+// limits the runtime of the plugin when loading its checker and checks
+func NewPluginChecker(log *logger.Log, filename string, timeout time.Duration) (*PluginChecker, error) {
+	c := &PluginChecker{
+		log:      log,
+		filename: filename,
+		timeout:  timeout,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	resp := &apiagent.PluginV1GetCheckerResponse{}
+
+	err := c.run(
+		ctx,
+		pluginCommandGetChecker,
+		&apiagent.PluginV1GetCheckerRequest{
+			AgentVersion: buildvars.BuildVersion,
+		},
+		resp,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Checker == nil || resp.Checker.Type == "" {
+		return nil, fmt.Errorf("plugin %s returned no checker type", c.name())
+	}
+
+	if resp.Checker.Name == "" {
+		resp.Checker.Name = c.name()
+	}
+
+	c.checker = resp.Checker
+
+	return c, nil
+}
@@ -6,7 +6,6 @@ import (
 
 	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
 	"github.com/shirou/gopsutil/process"
-	"gopkg.in/guregu/null.v4"
 )
 
 const CheckerTypeProcess = "com.indece.agent.linux.v1.checker.process"
@@ -45,68 +44,51 @@ func (c *ProcessChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	return []*apiagent.CheckV1{}, nil
 }
 
-func (c *ProcessChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
-	var err error
-
-	paramName := null.String{}
-
-	for _, param := range params {
-		if param.Value == "" {
-			continue
-		}
-
-		switch param.Name {
-		case "name":
-			paramName.Scan(param.Value)
-		default:
-			return "", nil, fmt.Errorf("unknown parameter '%s'", param.Name)
-		}
+func (c *ProcessChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
 	}
 
-	if !paramName.Valid || paramName.String == "" {
-		return "", nil, fmt.Errorf("missing parameter 'name'")
-	}
+	paramName := checkParams.String("name", "")
 
-	processes, err := process.Processes()
+	processes, err := process.ProcessesWithContext(ctx)
 	if err != nil {
-		return "", nil, fmt.Errorf("error loading running processes: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading running processes: %s", err)
 	}
 
 	var foundProcess *process.Process
 
 	for _, process := range processes {
-		name, err := process.Name()
+		name, err := process.NameWithContext(ctx)
 		if err != nil {
 			// Ignore errors here (caused if the process terminates before we can read the name)
 			continue
 		}
 
-		if name == paramName.String {
+		if name == paramName {
 			foundProcess = process
 			break
 		}
 	}
 
 	if foundProcess == nil {
-		return "", nil, fmt.Errorf("no running process with name '%s' found", paramName.String)
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", nil, fmt.Errorf("no running process with name '%s' found", paramName)
 	}
 
-	processName, err := foundProcess.Name()
+	processName, err := foundProcess.NameWithContext(ctx)
 	if err != nil {
-		return "", nil, fmt.Errorf("error getting process name: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error getting process name: %s", err)
 	}
 
-	processStatus, err := foundProcess.Status()
+	processStatus, err := foundProcess.StatusWithContext(ctx)
 	if err != nil {
-		return "", nil, fmt.Errorf("error getting process status: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error getting process status: %s", err)
 	}
 
 	values := []*apiagent.CheckV1Value{}
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "status",
-		Value: processStatus,
-	})
+	values = append(values, newCheckValueText("status", processStatus))
 
 	message := fmt.Sprintf(
 		"Process %s (%d) is running (%s)",
@@ -115,7 +97,7 @@ func (c *ProcessChecker) Check(ctx context.Context, params []*apiagent.CheckV1Pa
 		processStatus,
 	)
 
-	return message, values, nil
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
 }
 
 var _ IChecker = (*ProcessChecker)(nil)
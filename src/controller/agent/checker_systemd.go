@@ -0,0 +1,297 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/indece-official/monitor-agent-linux/src/generated/model/apiagent"
+	"github.com/indece-official/monitor-agent-linux/src/utils"
+)
+
+const CheckerTypeSystemd = "com.indece.agent.linux.v1.checker.systemd"
+
+// Timeout for loading the enabled services when autodiscovering checks
+const systemdDiscoveryTimeout = 10 * time.Second
+
+// SystemdChecker checks the state of a systemd unit via D-Bus or, without
+// unit, if any unit has failed
+type SystemdChecker struct {
+}
+
+func (c *SystemdChecker) GetType() string {
+	return CheckerTypeSystemd
+}
+
+func (c *SystemdChecker) GetChecker() (*apiagent.CheckerV1, error) {
+	return &apiagent.CheckerV1{
+		Name:         "Systemd",
+		Type:         CheckerTypeSystemd,
+		Version:      "",
+		CustomChecks: true,
+		Params: []*apiagent.CheckerV1Param{
+			{
+				Name:  "unit",
+				Label: "Unit",
+				Hint:  "Leave empty to check for failed units",
+				Type:  apiagent.CheckerV1ParamType_CheckerV1ParamTypeText,
+			},
+		},
+		Values: []*apiagent.CheckerV1Value{
+			{
+				Name: "active_state",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeText,
+			},
+			{
+				Name: "sub_state",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeText,
+			},
+			{
+				Name: "result",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeText,
+			},
+			{
+				Name: "restarts",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+			{
+				Name: "state_changed",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeDuration,
+			},
+			{
+				Name: "failed_units",
+				Type: apiagent.CheckerV1ValueType_CheckerV1ValueTypeNumber,
+			},
+		},
+	}, nil
+}
+
+// systemdBooted returns true if the system was booted with systemd
+// (see sd_booted(3))
+func systemdBooted() bool {
+	_, err := os.Stat("/run/systemd/system")
+
+	return err == nil
+}
+
+// enabledServices returns the enabled services, services activated by a
+// socket or timer are included, checkUnit accepts them being inactive
+func (c *SystemdChecker) enabledServices(ctx context.Context) ([]string, error) {
+	conn, err := dbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to systemd: %s", err)
+	}
+	defer conn.Close()
+
+	unitFiles, err := conn.ListUnitFilesByPatternsContext(ctx, []string{"enabled"}, []string{"*.service"})
+	if err != nil {
+		return nil, fmt.Errorf("error loading enabled services: %s", err)
+	}
+
+	services := []string{}
+	mapServices := map[string]bool{}
+
+	for _, unitFile := range unitFiles {
+		unit := filepath.Base(unitFile.Path)
+
+		if strings.HasSuffix(unit, "@.service") || mapServices[unit] {
+			// Ignore templates and repeated units
+			continue
+		}
+
+		mapServices[unit] = true
+		services = append(services, unit)
+	}
+
+	sort.Strings(services)
+
+	return services, nil
+}
+
+// GetChecks returns a check for failed units and a check for each enabled
+// service, the check for failed units is also returned if the services
+// can't be loaded
+func (c *SystemdChecker) GetChecks() ([]*apiagent.CheckV1, error) {
+	checks := []*apiagent.CheckV1{}
+
+	if !systemdBooted() {
+		return checks, nil
+	}
+
+	checks = append(checks, &apiagent.CheckV1{
+		Name:        "Systemd failed units",
+		Type:        CheckerTypeSystemd,
+		CheckerType: CheckerTypeSystemd,
+		Params:      []*apiagent.CheckV1Param{},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), systemdDiscoveryTimeout)
+	defer cancel()
+
+	units, err := c.enabledServices(ctx)
+	if err != nil {
+		// The check for failed units reports the error when it is run
+		return checks, nil
+	}
+
+	for _, unit := range units {
+		checks = append(checks, &apiagent.CheckV1{
+			Name:        fmt.Sprintf("Systemd %s", unit),
+			Type:        fmt.Sprintf("%s:%s", CheckerTypeSystemd, unit),
+			CheckerType: CheckerTypeSystemd,
+			Params: []*apiagent.CheckV1Param{
+				{
+					Name:  "unit",
+					Value: unit,
+				},
+			},
+		})
+	}
+
+	return checks, nil
+}
+
+// systemdUnitType returns the D-Bus interface suffix for the type of a unit
+// (e.g. "Service" for "ssh.service")
+func systemdUnitType(unit string) string {
+	suffix := strings.TrimPrefix(filepath.Ext(unit), ".")
+	if suffix == "" {
+		return ""
+	}
+
+	return strings.ToUpper(suffix[:1]) + suffix[1:]
+}
+
+func (c *SystemdChecker) checkFailedUnits(ctx context.Context, conn *dbus.Conn) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	failedUnits, err := conn.ListUnitsFilteredContext(ctx, []string{"failed"})
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading failed units: %s", err)
+	}
+
+	names := []string{}
+	for _, failedUnit := range failedUnits {
+		names = append(names, failedUnit.Name)
+	}
+
+	sort.Strings(names)
+
+	values := []*apiagent.CheckV1Value{}
+
+	values = append(values, newCheckValueInt("failed_units", int64(len(names)), ""))
+
+	if len(names) > 0 {
+		message := fmt.Sprintf(
+			"%d unit(s) failed: %s",
+			len(names),
+			strings.Join(names, ", "),
+		)
+
+		return apiagent.CheckV1Status_CheckV1StatusCritical, message, values, nil
+	}
+
+	return apiagent.CheckV1Status_CheckV1StatusOK, "No failed units", values, nil
+}
+
+func (c *SystemdChecker) checkUnit(ctx context.Context, conn *dbus.Conn, unit string) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	unitProps, err := conn.GetUnitPropertiesContext(ctx, unit)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error loading properties of unit %s: %s", unit, err)
+	}
+
+	loadState, _ := unitProps["LoadState"].(string)
+	activeState, _ := unitProps["ActiveState"].(string)
+	subState, _ := unitProps["SubState"].(string)
+	stateChangedAt, _ := unitProps["StateChangeTimestamp"].(uint64)
+	triggeredBy, _ := unitProps["TriggeredBy"].([]string)
+
+	if loadState == "not-found" {
+		return apiagent.CheckV1Status_CheckV1StatusCritical, "", nil, fmt.Errorf("unit %s not found", unit)
+	}
+
+	// The type specific properties are missing for some unit types (e.g. targets)
+	typeProps, err := conn.GetUnitTypePropertiesContext(ctx, unit, systemdUnitType(unit))
+	if err != nil {
+		typeProps = map[string]interface{}{}
+	}
+
+	result, _ := typeProps["Result"].(string)
+	serviceType, _ := typeProps["Type"].(string)
+
+	values := []*apiagent.CheckV1Value{}
+
+	values = append(values, newCheckValueText("active_state", activeState))
+
+	values = append(values, newCheckValueText("sub_state", subState))
+
+	values = append(values, newCheckValueText("result", result))
+
+	if restarts, ok := typeProps["NRestarts"].(uint32); ok {
+		values = append(values, newCheckValueInt("restarts", int64(restarts), ""))
+	}
+
+	message := fmt.Sprintf("Unit %s is %s (%s)", unit, activeState, subState)
+
+	// The timestamp is 0 if the state didn't change since boot
+	if stateChangedAt > 0 {
+		stateChanged := time.Since(time.UnixMicro(int64(stateChangedAt)))
+
+		values = append(values, newCheckValueDuration("state_changed", stateChanged))
+
+		message = fmt.Sprintf("%s since %s", message, utils.FormatDurationPretty(stateChanged))
+	}
+	if result != "" && result != "success" {
+		message = fmt.Sprintf("%s, result %s", message, result)
+	}
+
+	switch activeState {
+	case "active", "reloading":
+		return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
+	case "activating", "deactivating":
+		return apiagent.CheckV1Status_CheckV1StatusWarning, message, values, nil
+	case "inactive":
+		// Oneshot services and services activated by a socket or timer are
+		// inactive after running successfully
+		if (serviceType == "oneshot" || len(triggeredBy) > 0) && result == "success" {
+			return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
+		}
+
+		return apiagent.CheckV1Status_CheckV1StatusCritical, message, values, nil
+	default:
+		return apiagent.CheckV1Status_CheckV1StatusCritical, message, values, nil
+	}
+}
+
+func (c *SystemdChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	checkParams, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
+	paramUnit := checkParams.String("unit", "")
+	if paramUnit != "" && filepath.Ext(paramUnit) == "" {
+		paramUnit += ".service"
+	}
+
+	conn, err := dbus.NewSystemConnectionContext(ctx)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, fmt.Errorf("error connecting to systemd: %s", err)
+	}
+	defer conn.Close()
+
+	if paramUnit == "" {
+		return c.checkFailedUnits(ctx, conn)
+	}
+
+	return c.checkUnit(ctx, conn, paramUnit)
+}
+
+var _ IChecker = (*SystemdChecker)(nil)
+
+func NewSystemdChecker() *SystemdChecker {
+	return &SystemdChecker{}
+}
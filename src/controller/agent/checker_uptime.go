@@ -51,20 +51,22 @@ func (c *UptimeChecker) GetChecks() ([]*apiagent.CheckV1, error) {
 	}, nil
 }
 
-func (c *UptimeChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (string, []*apiagent.CheckV1Value, error) {
+func (c *UptimeChecker) Check(ctx context.Context, params []*apiagent.CheckV1Param) (apiagent.CheckV1Status, string, []*apiagent.CheckV1Value, error) {
+	_, err := bindCheckParams(c, params)
+	if err != nil {
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", nil, err
+	}
+
 	values := []*apiagent.CheckV1Value{}
 
-	uptime, err := host.Uptime()
+	uptime, err := host.UptimeWithContext(ctx)
 	if err != nil {
-		return "", values, fmt.Errorf("error loading uptime: %s", err)
+		return apiagent.CheckV1Status_CheckV1StatusUnknown, "", values, fmt.Errorf("error loading uptime: %s", err)
 	}
 
 	uptimeDuration := time.Duration(uptime) * time.Second
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "uptime",
-		Value: uptimeDuration.String(),
-	})
+	values = append(values, newCheckValueDuration("uptime", uptimeDuration))
 
 	restartRequired := false
 
@@ -73,10 +75,7 @@ func (c *UptimeChecker) Check(ctx context.Context, params []*apiagent.CheckV1Par
 		restartRequired = true
 	}
 
-	values = append(values, &apiagent.CheckV1Value{
-		Name:  "restart_required",
-		Value: fmt.Sprintf("%d", utils.BoolToInt(restartRequired)),
-	})
+	values = append(values, newCheckValueBool("restart_required", restartRequired))
 
 	message := fmt.Sprintf(
 		"Host is up for %s",
@@ -87,7 +86,7 @@ func (c *UptimeChecker) Check(ctx context.Context, params []*apiagent.CheckV1Par
 		message += " (system restart required)"
 	}
 
-	return message, values, nil
+	return apiagent.CheckV1Status_CheckV1StatusOK, message, values, nil
 }
 
 var _ IChecker = (*UptimeChecker)(nil)
@@ -1,9 +1,10 @@
 //go:generate go run assets/generate.go
-//go:generate /bin/sh -c "mkdir -p generated/model/apiagent && protoc --go_out=./generated/model/ --go-grpc_out=./generated/model/ --proto_path=../assets/grpc/ ../assets/grpc/agent.proto"
+//go:generate /bin/sh -c "mkdir -p generated/model/apiagent && protoc --go_out=./generated/model/ --go-grpc_out=./generated/model/ --proto_path=../assets/grpc/ ../assets/grpc/agent.proto ../assets/grpc/plugin.proto"
 package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/indece-official/go-gousu/v2/gousu"
 	"github.com/indece-official/monitor-agent-linux/src/buildvars"
@@ -11,6 +12,42 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "enroll":
+			err := agent.Enroll(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+
+			return
+		case "check":
+			exitCode, err := agent.RunCheck(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			}
+
+			os.Exit(exitCode)
+		case "list-checkers":
+			err := agent.ListCheckers(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+
+			return
+		case "list-checks":
+			err := agent.ListChecks(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+
+			return
+		}
+	}
+
 	runner := gousu.NewRunner(buildvars.ProjectName, fmt.Sprintf("%s (Build %s)", buildvars.BuildVersion, buildvars.BuildDate))
 
 	runner.CreateController(agent.NewController)
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"strings"
@@ -75,3 +76,14 @@ func FormatDurationPretty(d time.Duration) string {
 
 	return strings.Join(strParts, " ")
 }
+
+// SleepContext sleeps for the given duration or until the context is done
+func SleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
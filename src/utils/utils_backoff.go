@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff calculates capped exponential backoff durations with jitter
+type Backoff struct {
+	Min     time.Duration
+	Max     time.Duration
+	attempt int
+}
+
+// Next returns the duration to wait before the next attempt
+//
+// The duration doubles with every attempt (capped at Max), half of it is
+// randomized to spread the attempts of many clients
+func (b *Backoff) Next() time.Duration {
+	d := b.Min
+	for i := 0; i < b.attempt && d < b.Max; i++ {
+		d *= 2
+	}
+
+	if d > b.Max {
+		d = b.Max
+	}
+
+	b.attempt++
+
+	if d <= 1 {
+		return d
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+// Reset resets the backoff after a successful attempt
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
+
+func NewBackoff(min time.Duration, max time.Duration) *Backoff {
+	return &Backoff{
+		Min: min,
+		Max: max,
+	}
+}
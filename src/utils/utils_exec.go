@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// CommandContext creates a command running in its own process group, so
+// the command and all of its child processes are killed when the context
+// is done
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Don't wait forever for orphaned children holding stdout / stderr open
+	cmd.WaitDelay = 5 * time.Second
+
+	return cmd
+}